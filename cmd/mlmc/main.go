@@ -1,10 +1,19 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/mtlprog/mlm"
 	"github.com/mtlprog/mlm/config"
@@ -17,23 +26,35 @@ import (
 	"github.com/go-telegram/bot/models"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mdp/qrterminal/v3"
+	"github.com/stellar/go/amount"
 	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/strkey"
 	"github.com/urfave/cli/v3"
+	"rsc.io/qr"
 )
 
+var diffFlag = &cli.BoolFlag{
+	Name:  "diff",
+	Usage: "Add changes since the previous report to the report",
+}
+
 type app struct {
-	cfg     *config.Config
-	log     *slog.Logger
-	pg      *pgx.Conn
-	q       *db.Queries
-	stellar *stellar.Client
-	distrib *distributor.Distributor
+	cfg       *config.Config
+	log       *slog.Logger
+	pg        *pgx.Conn
+	q         *db.Queries
+	stellar   *stellar.Client
+	distrib   *distributor.Distributor
+	submitter *distributor.Submitter
 }
 
 func main() {
 	defer os.Stderr.Sync()
 
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	l := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
 		Level: slog.LevelDebug,
@@ -56,17 +77,37 @@ func main() {
 	defer pg.Close(ctx)
 
 	q := db.New(pg)
-	cl := horizonclient.DefaultPublicNetClient
-	stell := stellar.NewClient(cl)
-	distrib := distributor.New(cfg, stell, q, pg)
+	readRetry := stellar.DefaultReadRetryPolicy
+	readRetry.MaxRetries = cfg.HorizonReadRetries
+	submitRetry := stellar.DefaultSubmitRetryPolicy
+	submitRetry.MaxRetries = cfg.HorizonSubmitRetries
+	cl := stellar.NewRetryingClient(
+		ctx,
+		&horizonclient.Client{HorizonURL: cfg.HorizonURL, HTTP: http.DefaultClient},
+		l,
+		stellar.WithReadRetryPolicy(readRetry),
+		stellar.WithSubmitRetryPolicy(submitRetry),
+	)
+	stell := stellar.NewClient(cl,
+		stellar.WithNetworkPassphrase(cfg.NetworkPassphrase),
+		stellar.WithAssets(cfg.Assets),
+	)
+	policy, err := distributor.NewRewardPolicy(cfg)
+	if err != nil {
+		l.ErrorContext(ctx, err.Error())
+		os.Exit(1)
+	}
+
+	distrib := distributor.New(cfg, stell, q, pg, policy)
 
 	a := &app{
-		cfg:     cfg,
-		log:     l,
-		pg:      pg,
-		q:       q,
-		stellar: stell,
-		distrib: distrib,
+		cfg:       cfg,
+		log:       l,
+		pg:        pg,
+		q:         q,
+		stellar:   stell,
+		distrib:   distrib,
+		submitter: distributor.NewSubmitter(cfg, q, distrib, stell, l),
 	}
 
 	cmd := &cli.Command{
@@ -86,13 +127,62 @@ func main() {
 					{
 						Name:   "dry",
 						Usage:  "Generate dry-run report without saving to database",
+						Flags:  []cli.Flag{diffFlag},
 						Action: a.reportDry,
 					},
 					{
 						Name:   "create",
 						Usage:  "Generate and save report to database",
+						Flags:  []cli.Flag{diffFlag},
 						Action: a.reportCreate,
 					},
+					{
+						Name:      "diff",
+						Usage:     "Show changes of report b since report a (default: the last two reports)",
+						ArgsUsage: "[<a> <b>]",
+						Action:    a.reportDiff,
+					},
+					{
+						Name:      "verify",
+						Usage:     "Recalculate a saved report from its stored inputs and compare it with the database",
+						ArgsUsage: "<id>",
+						Action:    a.reportVerify,
+					},
+					{
+						Name:      "sign",
+						Usage:     "Add a signature to the unsubmitted report transactions for a multisig program account",
+						ArgsUsage: "<id>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "seed",
+								Usage:   "Secret key to sign with (default: read from stdin)",
+								Sources: cli.EnvVars("SIGNER_SEED"),
+							},
+						},
+						Action: a.reportSign,
+					},
+					{
+						Name:      "export-xdr",
+						Usage:     "Write the unsigned report transactions with an operation summary for offline signing",
+						ArgsUsage: "<id>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "out",
+								Usage: "File to write to (default: stdout)",
+							},
+							&cli.BoolFlag{
+								Name:  "qr",
+								Usage: "Print each transaction as a QR code to the terminal",
+							},
+						},
+						Action: a.reportExportXDR,
+					},
+					{
+						Name:      "import-signed",
+						Usage:     "Validate and store report transactions signed offline",
+						ArgsUsage: "<id> <file>",
+						Action:    a.reportImportSigned,
+					},
 				},
 			},
 			{
@@ -100,6 +190,68 @@ func main() {
 				Usage:  "Submit pending report or create new one and submit",
 				Action: a.distribute,
 			},
+			{
+				Name:  "conflict",
+				Usage: "Recommendation conflict management",
+				Commands: []*cli.Command{
+					{
+						Name:      "resolve",
+						Usage:     "Credit a doubly-recommended account to one recommender (CONFLICT_POLICY=manual)",
+						ArgsUsage: "<recommended> <recommender>",
+						Action:    a.conflictResolve,
+					},
+				},
+			},
+			{
+				Name:  "exclusion",
+				Usage: "Accounts barred from earning or generating rewards",
+				Commands: []*cli.Command{
+					{
+						Name:      "add",
+						Usage:     "Exclude an account from rewards as recommender and as recommended",
+						ArgsUsage: "<account>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "reason",
+								Usage:    "Why the account is excluded",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:    "author",
+								Usage:   "Who excluded the account",
+								Sources: cli.EnvVars("USER"),
+							},
+							&cli.StringFlag{
+								Name:  "expires",
+								Usage: "Date the exclusion expires, YYYY-MM-DD (default: never)",
+							},
+						},
+						Action: a.exclusionAdd,
+					},
+					{
+						Name:      "remove",
+						Usage:     "Lift an account exclusion",
+						ArgsUsage: "<account>",
+						Action:    a.exclusionRemove,
+					},
+					{
+						Name:   "list",
+						Usage:  "List account exclusions",
+						Action: a.exclusionList,
+					},
+				},
+			},
+			{
+				Name:  "claimable",
+				Usage: "Claimable balance management",
+				Commands: []*cli.Command{
+					{
+						Name:   "reclaim",
+						Usage:  "Reclaim expired unclaimed rewards back to the program account",
+						Action: a.claimableReclaim,
+					},
+				},
+			},
 			{
 				Name:  "token",
 				Usage: "Token management",
@@ -121,7 +273,12 @@ func main() {
 }
 
 func (a *app) reportDry(ctx context.Context, cmd *cli.Command) error {
-	res, err := a.distrib.Distribute(ctx, mlm.WithoutReport())
+	opts := []mlm.DistributeOption{mlm.WithoutReport()}
+	if cmd.Bool("diff") {
+		opts = append(opts, mlm.WithDiff())
+	}
+
+	res, err := a.distrib.Distribute(ctx, opts...)
 	if err != nil {
 		return err
 	}
@@ -130,10 +287,16 @@ func (a *app) reportDry(ctx context.Context, cmd *cli.Command) error {
 		slog.Int("conflicts", len(res.Conflicts)),
 		slog.Int("distributes", len(res.Distributes)),
 		slog.Int("recommends", len(res.Recommends)),
-		slog.Float64("amount", res.Amount),
-		slog.Float64("amount_per_tag", res.AmountPerTag),
 	)
 
+	for _, asset := range res.Assets {
+		a.log.InfoContext(ctx, "dry report asset",
+			slog.String("asset", asset.Asset.Code),
+			slog.String("amount", amount.StringFromInt64(asset.Amount)),
+			slog.String("amount_per_tag", amount.StringFromInt64(asset.AmountPerTag)),
+		)
+	}
+
 	if cmd.Root().Bool("notify-tg") {
 		return a.sendTelegramNotification(ctx, res)
 	}
@@ -142,7 +305,12 @@ func (a *app) reportDry(ctx context.Context, cmd *cli.Command) error {
 }
 
 func (a *app) reportCreate(ctx context.Context, cmd *cli.Command) error {
-	res, err := a.distrib.Distribute(ctx)
+	var opts []mlm.DistributeOption
+	if cmd.Bool("diff") {
+		opts = append(opts, mlm.WithDiff())
+	}
+
+	res, err := a.distrib.Distribute(ctx, opts...)
 	if err != nil {
 		return err
 	}
@@ -161,6 +329,332 @@ func (a *app) reportCreate(ctx context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+func (a *app) reportVerify(ctx context.Context, cmd *cli.Command) error {
+	reportID, err := strconv.ParseInt(cmd.Args().Get(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid report id %q, usage: mlmc report verify <id>", cmd.Args().Get(0))
+	}
+
+	v, err := a.distrib.Verify(ctx, reportID)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range v.Mismatches {
+		a.log.WarnContext(ctx, "report mismatch",
+			slog.Int64("report_id", reportID),
+			slog.String("kind", m.Kind),
+			slog.String("key", m.Key),
+			slog.String("expected", m.Expected),
+			slog.String("actual", m.Actual),
+		)
+	}
+
+	if !v.OK() {
+		return fmt.Errorf("report %d does not match its replay: %d mismatches", reportID, len(v.Mismatches))
+	}
+
+	a.log.InfoContext(ctx, "report verified", slog.Int64("report_id", reportID))
+
+	return nil
+}
+
+// reportSign добавляет подпись ключа из --seed или stdin к невыполненным транзакциям отчёта
+// и для каждой транзакции показывает собранный вес подписей и порог, нужный для отправки.
+func (a *app) reportSign(ctx context.Context, cmd *cli.Command) error {
+	reportID, err := strconv.ParseInt(cmd.Args().Get(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid report id %q, usage: mlmc report sign <id>", cmd.Args().Get(0))
+	}
+
+	txs, _, err := a.unsubmittedTransactions(ctx, reportID)
+	if err != nil {
+		return err
+	}
+
+	seed := cmd.String("seed")
+	if seed == "" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		seed = strings.TrimSpace(line)
+	}
+
+	for _, t := range txs {
+		signed, err := a.stellar.SignXDR(distributor.SignedEnvelope(t), seed)
+		if err != nil {
+			return fmt.Errorf("sign transaction %d of report %d: %w", t.Chunk+1, reportID, err)
+		}
+
+		if err := a.storeSignedXDR(ctx, t, signed); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reportExportXDR выгружает невыполненные транзакции отчёта без подписей, хэш отчёта
+// и описание операций в файл или в терминал QR-кодами для подписи на отдельной машине
+func (a *app) reportExportXDR(ctx context.Context, cmd *cli.Command) error {
+	reportID, err := strconv.ParseInt(cmd.Args().Get(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid report id %q, usage: mlmc report export-xdr <id>", cmd.Args().Get(0))
+	}
+
+	txs, total, err := a.unsubmittedTransactions(ctx, reportID)
+	if err != nil {
+		return err
+	}
+
+	export, err := distributor.NewExport(reportID, a.cfg.NetworkPassphrase, total, txs)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if path := cmd.String("out"); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if cmd.Bool("qr") {
+		return writeExportQR(w, export)
+	}
+
+	if err := export.Write(w); err != nil {
+		return err
+	}
+
+	a.log.InfoContext(ctx, "report transactions exported",
+		slog.Int64("report_id", reportID),
+		slog.String("report_hash", export.ReportHash),
+		slog.Int("transactions", len(export.Transactions)),
+	)
+
+	return nil
+}
+
+// writeExportQR печатает описание каждой транзакции и её XDR QR-кодом.
+// QR-код вмещает около 2,9 КБ, большие транзакции нужно выгружать в файл.
+func writeExportQR(w io.Writer, export distributor.Export) error {
+	fmt.Fprintf(w, "report: %d\nreport hash: %s\nnetwork: %s\n", export.ReportID, export.ReportHash, export.Network)
+
+	for _, t := range export.Transactions {
+		if _, err := qr.Encode(t.XDR, qr.L); err != nil {
+			return fmt.Errorf("transaction %d/%d is too large for a QR code, use --out: %w", t.Chunk+1, t.Total, err)
+		}
+
+		fmt.Fprintf(w, "\n%s", t.Header())
+		qrterminal.GenerateHalfBlock(t.XDR, qr.L, w)
+	}
+
+	return nil
+}
+
+// reportImportSigned проверяет и сохраняет транзакции отчёта, подписанные на другой машине.
+// Файл — выгрузка export-xdr с подписанными XDR или просто XDR по одной в строке.
+// Каждая транзакция должна совпадать по хэшу с невыполненной транзакцией отчёта
+// и добавлять хотя бы одну подпись подписанта счёта.
+func (a *app) reportImportSigned(ctx context.Context, cmd *cli.Command) error {
+	reportID, err := strconv.ParseInt(cmd.Args().Get(0), 10, 64)
+	if err != nil || cmd.Args().Len() != 2 {
+		return fmt.Errorf("usage: mlmc report import-signed <id> <file>")
+	}
+
+	txs, _, err := a.unsubmittedTransactions(ctx, reportID)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(cmd.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reportHash, xdrs, err := distributor.ReadSigned(f)
+	if err != nil {
+		return err
+	}
+
+	if reportHash != "" && reportHash != distributor.ReportHash(txs) {
+		return fmt.Errorf("report %d transactions changed since export, export and sign them again", reportID)
+	}
+
+	if len(xdrs) == 0 {
+		return fmt.Errorf("no signed transactions in %s", cmd.Args().Get(1))
+	}
+
+	byHash := make(map[string]db.ReportTransaction, len(txs))
+	for _, t := range txs {
+		hash, err := a.stellar.TransactionHash(t.Xdr)
+		if err != nil {
+			return err
+		}
+		byHash[hash] = t
+	}
+
+	for _, signed := range xdrs {
+		hash, err := a.stellar.TransactionHash(signed)
+		if err != nil {
+			return fmt.Errorf("parse signed transaction: %w", err)
+		}
+
+		t, ok := byHash[hash]
+		if !ok {
+			return fmt.Errorf("signed transaction %s is not an unsubmitted transaction of report %d", hash, reportID)
+		}
+
+		envelope := distributor.SignedEnvelope(t)
+
+		merged, err := a.stellar.MergeSignatures(envelope, signed)
+		if err != nil {
+			return err
+		}
+
+		before, _, err := a.stellar.SignatureWeight(ctx, envelope)
+		if err != nil {
+			return err
+		}
+
+		after, _, err := a.stellar.SignatureWeight(ctx, merged)
+		if err != nil {
+			return err
+		}
+
+		if after <= before {
+			return fmt.Errorf("signed transaction %s adds no signatures of the account signers", hash)
+		}
+
+		if err := a.storeSignedXDR(ctx, t, merged); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unsubmittedTransactions возвращает невыполненные транзакции отчёта и число всех его транзакций
+func (a *app) unsubmittedTransactions(ctx context.Context, reportID int64) ([]db.ReportTransaction, int, error) {
+	all, err := a.q.GetReportTransactions(ctx, reportID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	txs := lo.Filter(all, func(t db.ReportTransaction, _ int) bool {
+		return t.Status != mlm.TransactionSuccess
+	})
+	if len(txs) == 0 {
+		return nil, 0, fmt.Errorf("report %d has no unsubmitted transactions", reportID)
+	}
+
+	return txs, len(all), nil
+}
+
+// storeSignedXDR сохраняет транзакцию с подписями и показывает собранный вес
+func (a *app) storeSignedXDR(ctx context.Context, t db.ReportTransaction, signed string) error {
+	if signed != distributor.SignedEnvelope(t) {
+		if err := a.q.SetReportTransactionSignedXDR(ctx, db.SetReportTransactionSignedXDRParams{
+			SignedXdr: pgtype.Text{String: signed, Valid: true},
+			ReportID:  t.ReportID,
+			Chunk:     t.Chunk,
+		}); err != nil {
+			return err
+		}
+	}
+
+	weight, threshold, err := a.stellar.SignatureWeight(ctx, signed)
+	if err != nil {
+		return err
+	}
+
+	a.log.InfoContext(ctx, "transaction signed",
+		slog.Int64("report_id", t.ReportID),
+		slog.Int("chunk", int(t.Chunk)),
+		slog.Int("weight", int(weight)),
+		slog.Int("threshold", int(threshold)),
+	)
+
+	return nil
+}
+
+func (a *app) reportDiff(ctx context.Context, cmd *cli.Command) error {
+	var from, to int64
+
+	switch cmd.Args().Len() {
+	case 0:
+		rr, err := a.q.GetReports(ctx, 2)
+		if err != nil {
+			return err
+		}
+		if len(rr) < 2 {
+			return errors.New("need at least two reports to diff")
+		}
+		from, to = rr[1].ID, rr[0].ID
+	case 2:
+		var err error
+		if from, err = strconv.ParseInt(cmd.Args().Get(0), 10, 64); err != nil {
+			return fmt.Errorf("invalid report id %q, usage: mlmc report diff [<a> <b>]", cmd.Args().Get(0))
+		}
+		if to, err = strconv.ParseInt(cmd.Args().Get(1), 10, 64); err != nil {
+			return fmt.Errorf("invalid report id %q, usage: mlmc report diff [<a> <b>]", cmd.Args().Get(1))
+		}
+	default:
+		return errors.New("usage: mlmc report diff [<a> <b>]")
+	}
+
+	diff, err := a.distrib.Diff(ctx, from, to)
+	if err != nil {
+		return err
+	}
+
+	log := a.log.With(slog.Int64("from", diff.From), slog.Int64("to", diff.To))
+
+	for _, accountID := range diff.NewRecommenders {
+		log.InfoContext(ctx, "new recommender", slog.String("account", accountID))
+	}
+	for _, accountID := range diff.VanishedRecommenders {
+		log.InfoContext(ctx, "vanished recommender", slog.String("account", accountID))
+	}
+	for _, m := range diff.Moved {
+		log.InfoContext(ctx, "recommendation moved",
+			slog.String("recommended", m.Recommended),
+			slog.Any("from", m.From),
+			slog.Any("to", m.To),
+		)
+	}
+	for _, d := range diff.MTLAPDrops {
+		log.InfoContext(ctx, "MTLAP dropped",
+			slog.String("recommended", d.Recommended),
+			slog.Int64("from", d.From),
+			slog.Int64("to", d.To),
+		)
+	}
+	for _, recommended := range diff.ConflictsAppeared {
+		log.InfoContext(ctx, "conflict appeared", slog.String("recommended", recommended))
+	}
+	for _, recommended := range diff.ConflictsResolved {
+		log.InfoContext(ctx, "conflict resolved", slog.String("recommended", recommended))
+	}
+
+	log.InfoContext(ctx, "report diff done",
+		slog.Int("new_recommenders", len(diff.NewRecommenders)),
+		slog.Int("vanished_recommenders", len(diff.VanishedRecommenders)),
+		slog.Int("moved", len(diff.Moved)),
+		slog.Int("mtlap_drops", len(diff.MTLAPDrops)),
+		slog.Int("conflicts_appeared", len(diff.ConflictsAppeared)),
+		slog.Int("conflicts_resolved", len(diff.ConflictsResolved)),
+	)
+
+	return nil
+}
+
 func (a *app) distribute(ctx context.Context, cmd *cli.Command) error {
 	pendingReport, err := a.q.GetPendingReport(ctx)
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
@@ -187,23 +681,10 @@ func (a *app) distribute(ctx context.Context, cmd *cli.Command) error {
 		}
 	}
 
-	hash, err := a.stellar.SubmitXDR(ctx, a.cfg.Seed, res.XDR)
-	if err != nil {
+	if err := a.submitter.Submit(ctx, res.ReportID); err != nil {
 		return err
 	}
 
-	if err := a.q.SetReportHash(ctx, db.SetReportHashParams{
-		Hash:     pgtype.Text{String: hash, Valid: true},
-		ReportID: res.ReportID,
-	}); err != nil {
-		return err
-	}
-
-	a.log.InfoContext(ctx, "transaction submitted",
-		slog.Int64("report_id", res.ReportID),
-		slog.String("hash", hash),
-	)
-
 	if cmd.Root().Bool("notify-tg") {
 		return a.sendTelegramNotification(ctx, res)
 	}
@@ -227,13 +708,41 @@ func (a *app) buildResultFromReport(ctx context.Context, rep db.Report) (*mlm.Di
 		return nil, err
 	}
 
+	txs, err := a.q.GetReportTransactions(ctx, rep.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	carryover, err := a.q.GetCarryover(ctx, rep.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	arrears, err := a.q.GetArrears(ctx, rep.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	exclusions, err := a.q.GetReportExclusions(ctx, rep.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	budgets, err := distributor.BudgetsFromJSON(rep.Budget)
+	if err != nil {
+		return nil, fmt.Errorf("decode budget of report %d: %w", rep.ID, err)
+	}
+
 	return &mlm.DistributeResult{
 		ReportID:      rep.ID,
-		XDR:           rep.Xdr,
+		XDRs:          lo.Map(txs, func(t db.ReportTransaction, _ int) string { return t.Xdr }),
 		CreatedAt:     rep.CreatedAt.Time,
 		Recommends:    recommends,
 		Distributes:   distributes,
 		Conflicts:     conflicts,
+		Assets:        distributor.AssetsFromReport(budgets, carryover),
+		Arrears:       distributor.ArrearsFromRows(arrears),
+		Exclusions:    exclusions,
 		SourceAddress: a.cfg.Address,
 	}, nil
 }
@@ -255,12 +764,180 @@ func (a *app) sendTelegramNotification(ctx context.Context, res *mlm.DistributeR
 	return err
 }
 
+func (a *app) conflictResolve(ctx context.Context, cmd *cli.Command) error {
+	recommended, recommender := cmd.Args().Get(0), cmd.Args().Get(1)
+
+	for _, accountID := range []string{recommended, recommender} {
+		if !strkey.IsValidEd25519PublicKey(accountID) {
+			return fmt.Errorf("invalid account id %q, usage: mlmc conflict resolve <recommended> <recommender>", accountID)
+		}
+	}
+
+	if err := a.q.SetConflictResolution(ctx, db.SetConflictResolutionParams{
+		Recommended: recommended,
+		Recommender: recommender,
+	}); err != nil {
+		return err
+	}
+
+	a.log.InfoContext(ctx, "conflict resolved",
+		slog.String("recommended", recommended),
+		slog.String("recommender", recommender),
+		slog.String("policy", a.cfg.ConflictPolicy),
+	)
+
+	if a.cfg.ConflictPolicy != config.ConflictPolicyManual {
+		a.log.WarnContext(ctx, "resolution is stored but applied only with CONFLICT_POLICY=manual")
+	}
+
+	return nil
+}
+
+func (a *app) exclusionAdd(ctx context.Context, cmd *cli.Command) error {
+	accountID := cmd.Args().Get(0)
+	if !strkey.IsValidEd25519PublicKey(accountID) {
+		return fmt.Errorf("invalid account id %q, usage: mlmc exclusion add <account> --reason <reason>", accountID)
+	}
+
+	if cmd.String("author") == "" {
+		return errors.New("author is required: set --author or USER")
+	}
+
+	var expiresAt pgtype.Timestamptz
+
+	if expires := cmd.String("expires"); expires != "" {
+		t, err := time.Parse(time.DateOnly, expires)
+		if err != nil {
+			return fmt.Errorf("invalid expiry date %q: %w", expires, err)
+		}
+		expiresAt = pgtype.Timestamptz{Time: t, Valid: true}
+	}
+
+	if err := a.q.SetExclusion(ctx, db.SetExclusionParams{
+		AccountID: accountID,
+		Reason:    cmd.String("reason"),
+		Author:    cmd.String("author"),
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return err
+	}
+
+	a.log.InfoContext(ctx, "account excluded",
+		slog.String("account", accountID),
+		slog.String("reason", cmd.String("reason")),
+		slog.String("author", cmd.String("author")),
+		slog.String("expires", cmd.String("expires")),
+	)
+
+	return nil
+}
+
+func (a *app) exclusionRemove(ctx context.Context, cmd *cli.Command) error {
+	accountID := cmd.Args().Get(0)
+	if !strkey.IsValidEd25519PublicKey(accountID) {
+		return fmt.Errorf("invalid account id %q, usage: mlmc exclusion remove <account>", accountID)
+	}
+
+	n, err := a.q.DeleteExclusion(ctx, accountID)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("account %s is not excluded", accountID)
+	}
+
+	a.log.InfoContext(ctx, "exclusion removed", slog.String("account", accountID))
+
+	return nil
+}
+
+func (a *app) exclusionList(ctx context.Context, cmd *cli.Command) error {
+	exclusions, err := a.q.GetExclusions(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(exclusions) == 0 {
+		a.log.InfoContext(ctx, "no excluded accounts")
+		return nil
+	}
+
+	for _, e := range exclusions {
+		expires := "never"
+		if e.ExpiresAt.Valid {
+			expires = e.ExpiresAt.Time.Format(time.DateOnly)
+		}
+
+		a.log.InfoContext(ctx, "exclusion",
+			slog.String("account", e.AccountID),
+			slog.String("reason", e.Reason),
+			slog.String("author", e.Author),
+			slog.String("created", e.CreatedAt.Time.Format(time.DateOnly)),
+			slog.String("expires", expires),
+			slog.Bool("active", !e.ExpiresAt.Valid || e.ExpiresAt.Time.After(time.Now())),
+		)
+	}
+
+	return nil
+}
+
+func (a *app) claimableReclaim(ctx context.Context, cmd *cli.Command) error {
+	var balances []horizon.ClaimableBalance
+
+	for _, ra := range a.cfg.RewardAssets {
+		assetBalances, err := a.stellar.ReclaimableBalances(ctx, a.cfg.Address, ra.Code, ra.Issuer, time.Now())
+		if err != nil {
+			return err
+		}
+
+		balances = append(balances, assetBalances...)
+	}
+
+	if len(balances) == 0 {
+		a.log.InfoContext(ctx, "no expired claimable balances found, nothing to do")
+		return nil
+	}
+
+	for _, cb := range balances {
+		a.log.InfoContext(ctx, "expired claimable balance",
+			slog.String("id", cb.BalanceID),
+			slog.String("asset", cb.Asset),
+			slog.String("amount", cb.Amount),
+		)
+	}
+
+	hashes, err := a.stellar.ReclaimClaimableBalances(ctx, a.cfg.Address, a.cfg.Seed, lo.Map(balances, func(cb horizon.ClaimableBalance, _ int) string {
+		return cb.BalanceID
+	}))
+	for _, hash := range hashes {
+		a.log.InfoContext(ctx, "reclaim transaction submitted", slog.String("hash", hash))
+	}
+	if err != nil {
+		return err
+	}
+
+	a.log.InfoContext(ctx, "claimable balances reclaimed", slog.Int("count", len(balances)))
+
+	return nil
+}
+
 func (a *app) tokenSwap(ctx context.Context, cmd *cli.Command) error {
 	a.log.InfoContext(ctx, "starting token swap",
 		slog.Float64("price_threshold", a.cfg.SwapPriceThreshold),
 		slog.String("address", a.cfg.Address),
 	)
 
+	for _, ra := range a.cfg.RewardAssets {
+		if lo.ContainsBy(a.stellar.SwappableTokens(), func(t stellar.SwappableToken) bool {
+			return t.Code == ra.Code && t.Issuer == ra.Issuer
+		}) {
+			a.log.WarnContext(ctx, "reward asset will be swapped to LABR, its budget will shrink",
+				slog.String("asset", ra.Code),
+			)
+		}
+	}
+
 	// First check what balances we have
 	balances, err := a.stellar.GetSwappableBalances(ctx, a.cfg.Address)
 	if err != nil {
@@ -274,7 +951,7 @@ func (a *app) tokenSwap(ctx context.Context, cmd *cli.Command) error {
 	for _, bal := range balances {
 		a.log.InfoContext(ctx, "balance",
 			slog.String("asset", bal.Code),
-			slog.Float64("amount", bal.Balance),
+			slog.String("amount", amount.StringFromInt64(bal.Balance)),
 		)
 	}
 
@@ -292,8 +969,8 @@ func (a *app) tokenSwap(ctx context.Context, cmd *cli.Command) error {
 		slog.Int("swaps", len(summary.Swaps)),
 		slog.Int("price_exceeded", len(summary.PriceExceeded)),
 		slog.Int("errors", len(summary.Errors)),
-		slog.Float64("total_from_eur", summary.TotalFromEUR),
-		slog.Float64("total_to_labr", summary.TotalToLABR),
+		slog.String("total_from_eur", amount.StringFromInt64(summary.TotalFromEUR)),
+		slog.String("total_to_labr", amount.StringFromInt64(summary.TotalToLABR)),
 	)
 
 	for _, swapErr := range summary.Errors {
@@ -1,11 +1,22 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/stellar"
+	"github.com/samber/lo"
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/network"
 )
 
 type Config struct {
@@ -13,12 +24,70 @@ type Config struct {
 	TelegramToken           string
 	Address                 string
 	Seed                    string
+	HorizonURL              string
+	HorizonConcurrency      int
+	HorizonReadRetries      int
+	HorizonSubmitRetries    int
+	NetworkPassphrase       string
+	Assets                  stellar.Assets
 	ReportToChatID          int64
 	ReportToMessageThreadID int64
 	SwapPriceThreshold      float64
 	AlertMentionUsername    string
+	RewardPolicy            string
+	RewardTierWeights       []float64
+	RewardNewMemberBonus    float64
+	PayoutCap               int64   // в строупах
+	PayoutCapShare          float64 // в процентах от суммы распределения
+	PayoutCapExcess         string
+	MinPayout               int64 // в строупах
+	ArrearsExpiry           time.Duration
+	ClaimableBalancePeriod  time.Duration
+	TransactionValidity     time.Duration
+	ConflictPolicy          string
+	RewardAssets            []RewardAsset
+	MultilevelShares        []float64 // в процентах, начиная с уровня 2
+	MultilevelMaxDepth      int
+	VestingPeriod           time.Duration
+	VestingReports          int
+	GraphPolicy             mlm.GraphPolicy
+
+	rewardAssetsErr error
+	assetsErr       error
+	parseErr        error
+}
+
+// RewardAsset — актив награды со своей политикой бюджета. Суммы в строупах:
+// BudgetAmount и BudgetReserve — в самом активе, BudgetEUR — в EURMTL.
+type RewardAsset struct {
+	Code          string
+	Issuer        string
+	BudgetPolicy  string
+	BudgetAmount  int64
+	BudgetPercent float64
+	BudgetReserve int64
+	BudgetEUR     int64
 }
 
+const (
+	PayoutCapExcessRedistribute = "redistribute"
+	PayoutCapExcessCarryover    = "carryover"
+)
+
+const (
+	ConflictPolicySkip     = "skip"
+	ConflictPolicySplit    = "split"
+	ConflictPolicyEarliest = "earliest"
+	ConflictPolicyManual   = "manual"
+)
+
+const (
+	BudgetPolicyFixed   = "fixed"
+	BudgetPolicyPercent = "percent"
+	BudgetPolicyReserve = "reserve"
+	BudgetPolicyEUR     = "eur"
+)
+
 func (c *Config) Validate() error {
 	if c.PostgresDSN == "" {
 		return fmt.Errorf("POSTGRES_DSN is required")
@@ -26,12 +95,121 @@ func (c *Config) Validate() error {
 	if c.Address == "" {
 		return fmt.Errorf("STELLAR_ADDRESS is required")
 	}
-	if c.Seed == "" {
-		return fmt.Errorf("STELLAR_SEED is required")
+	if c.parseErr != nil {
+		return c.parseErr
+	}
+	if c.PayoutCap < 0 || c.MinPayout < 0 {
+		return fmt.Errorf("PAYOUT_CAP and MIN_PAYOUT must not be negative")
+	}
+	if c.ClaimableBalancePeriod < 0 {
+		return fmt.Errorf("CLAIMABLE_BALANCE_DAYS must not be negative")
+	}
+	if math.IsNaN(c.PayoutCapShare) || c.PayoutCapShare < 0 || c.PayoutCapShare > 100 {
+		return fmt.Errorf("PAYOUT_CAP_SHARE must be in [0, 100]")
+	}
+	if c.PayoutCapExcess != PayoutCapExcessRedistribute && c.PayoutCapExcess != PayoutCapExcessCarryover {
+		return fmt.Errorf("PAYOUT_CAP_EXCESS must be %s or %s", PayoutCapExcessRedistribute, PayoutCapExcessCarryover)
+	}
+	switch c.ConflictPolicy {
+	case ConflictPolicySkip, ConflictPolicySplit, ConflictPolicyEarliest, ConflictPolicyManual:
+	default:
+		return fmt.Errorf("CONFLICT_POLICY must be one of %s, %s, %s, %s",
+			ConflictPolicySkip, ConflictPolicySplit, ConflictPolicyEarliest, ConflictPolicyManual)
+	}
+	if slices.ContainsFunc(c.RewardTierWeights, isNotFinite) || isNotFinite(c.RewardNewMemberBonus) {
+		return fmt.Errorf("REWARD_TIER_WEIGHTS and REWARD_NEW_MEMBER_BONUS must be finite numbers")
+	}
+	for _, share := range c.MultilevelShares {
+		if math.IsNaN(share) || share < 0 || share > 100 {
+			return fmt.Errorf("MULTILEVEL_SHARES must be in [0, 100]")
+		}
+	}
+	if lo.Sum(c.MultilevelShares) > 100 {
+		return fmt.Errorf("sum of MULTILEVEL_SHARES must not exceed 100")
+	}
+	if c.MultilevelMaxDepth < 0 {
+		return fmt.Errorf("MULTILEVEL_MAX_DEPTH must not be negative")
+	}
+	if c.VestingPeriod < 0 || c.VestingReports < 0 {
+		return fmt.Errorf("VESTING_DAYS and VESTING_REPORTS must not be negative")
+	}
+	if c.VestingPeriod > 0 && c.VestingReports > 0 {
+		return fmt.Errorf("only one of VESTING_DAYS and VESTING_REPORTS can be set")
+	}
+	for _, p := range []struct{ name, policy string }{
+		{"GRAPH_SELF_LOOP_POLICY", c.GraphPolicy.SelfLoop},
+		{"GRAPH_MUTUAL_POLICY", c.GraphPolicy.Mutual},
+		{"GRAPH_CYCLE_POLICY", c.GraphPolicy.Cycle},
+	} {
+		switch p.policy {
+		case mlm.GraphPolicyIgnore, mlm.GraphPolicyExclude, mlm.GraphPolicyFlag:
+		default:
+			return fmt.Errorf("%s must be one of %s, %s, %s",
+				p.name, mlm.GraphPolicyIgnore, mlm.GraphPolicyExclude, mlm.GraphPolicyFlag)
+		}
+	}
+	if c.HorizonURL == "" {
+		return fmt.Errorf("HORIZON_URL is required")
+	}
+	if c.HorizonConcurrency < 1 {
+		return fmt.Errorf("HORIZON_CONCURRENCY must be positive")
+	}
+	if c.HorizonReadRetries < 0 || c.HorizonSubmitRetries < 0 {
+		return fmt.Errorf("HORIZON_READ_RETRIES and HORIZON_SUBMIT_RETRIES must not be negative")
+	}
+	if c.TransactionValidity <= 0 {
+		return fmt.Errorf("TX_VALIDITY_HOURS must be positive")
+	}
+	if c.NetworkPassphrase == "" {
+		return fmt.Errorf("STELLAR_NETWORK_PASSPHRASE is required")
+	}
+	if c.assetsErr != nil {
+		return c.assetsErr
+	}
+	if c.rewardAssetsErr != nil {
+		return fmt.Errorf("REWARD_ASSETS: %w", c.rewardAssetsErr)
+	}
+	if len(c.RewardAssets) == 0 {
+		return fmt.Errorf("at least one reward asset is required")
+	}
+	for _, a := range c.RewardAssets {
+		if err := a.validate(); err != nil {
+			return fmt.Errorf("reward asset %s: %w", a.Code, err)
+		}
 	}
 	return nil
 }
 
+func (a RewardAsset) validate() error {
+	if a.Code == "" || a.Issuer == "" {
+		return fmt.Errorf("code and issuer are required")
+	}
+
+	switch a.BudgetPolicy {
+	case BudgetPolicyFixed:
+		if a.BudgetAmount <= 0 {
+			return fmt.Errorf("budget amount is required for %s policy", BudgetPolicyFixed)
+		}
+	case BudgetPolicyPercent:
+		if a.BudgetPercent <= 0 || a.BudgetPercent > 100 {
+			return fmt.Errorf("budget percent must be in (0, 100]")
+		}
+	case BudgetPolicyReserve:
+		if a.BudgetReserve < 0 {
+			return fmt.Errorf("budget reserve must not be negative")
+		}
+	case BudgetPolicyEUR:
+		if a.BudgetEUR <= 0 {
+			return fmt.Errorf("budget EUR amount is required for %s policy", BudgetPolicyEUR)
+		}
+	default:
+		return fmt.Errorf("budget policy must be one of %s, %s, %s, %s",
+			BudgetPolicyFixed, BudgetPolicyPercent, BudgetPolicyReserve, BudgetPolicyEUR)
+	}
+
+	return nil
+}
+
 func Get() *Config {
 	_ = godotenv.Load()
 
@@ -48,14 +226,311 @@ func Get() *Config {
 		alertMentionUsername = "xdefrag"
 	}
 
+	rewardTierWeights, rewardTierWeightsErr := parseFloats("REWARD_TIER_WEIGHTS")
+	rewardNewMemberBonus, rewardNewMemberBonusErr := parseFloat("REWARD_NEW_MEMBER_BONUS")
+
+	payoutCap, payoutCapErr := parseAmount("PAYOUT_CAP")
+	payoutCapShare, payoutCapShareErr := parseFloat("PAYOUT_CAP_SHARE")
+
+	payoutCapExcess := os.Getenv("PAYOUT_CAP_EXCESS")
+	if payoutCapExcess == "" {
+		payoutCapExcess = PayoutCapExcessRedistribute
+	}
+
+	minPayout, minPayoutErr := parseAmount("MIN_PAYOUT")
+
+	arrearsExpiryDays, err := strconv.Atoi(os.Getenv("ARREARS_EXPIRY_DAYS"))
+	if err != nil {
+		arrearsExpiryDays = 90
+	}
+
+	claimableBalanceDays, claimableBalanceDaysErr := parseInt("CLAIMABLE_BALANCE_DAYS")
+
+	transactionValidityHours, err := strconv.Atoi(os.Getenv("TX_VALIDITY_HOURS"))
+	if err != nil {
+		transactionValidityHours = 24
+	}
+
+	horizonURL := os.Getenv("HORIZON_URL")
+	if horizonURL == "" {
+		horizonURL = horizonclient.DefaultPublicNetClient.HorizonURL
+	}
+
+	horizonConcurrency, err := strconv.Atoi(os.Getenv("HORIZON_CONCURRENCY"))
+	if err != nil {
+		horizonConcurrency = 8
+	}
+
+	horizonReadRetries, err := strconv.Atoi(os.Getenv("HORIZON_READ_RETRIES"))
+	if err != nil {
+		horizonReadRetries = stellar.DefaultReadRetryPolicy.MaxRetries
+	}
+
+	horizonSubmitRetries, err := strconv.Atoi(os.Getenv("HORIZON_SUBMIT_RETRIES"))
+	if err != nil {
+		horizonSubmitRetries = stellar.DefaultSubmitRetryPolicy.MaxRetries
+	}
+
+	networkPassphrase := os.Getenv("STELLAR_NETWORK_PASSPHRASE")
+	if networkPassphrase == "" {
+		networkPassphrase = network.PublicNetworkPassphrase
+	}
+
+	assets, assetsErr := parseAssets()
+
+	rewardAssets, rewardAssetsErr := parseRewardAssets(os.Getenv("REWARD_ASSETS"))
+	var budgetErr error
+	if len(rewardAssets) == 0 && rewardAssetsErr == nil {
+		var ra RewardAsset
+		ra, budgetErr = defaultRewardAsset(assets.LABR)
+		rewardAssets = []RewardAsset{ra}
+	}
+
+	conflictPolicy := os.Getenv("CONFLICT_POLICY")
+	if conflictPolicy == "" {
+		conflictPolicy = ConflictPolicySkip
+	}
+
+	multilevelShares, multilevelSharesErr := parseFloats("MULTILEVEL_SHARES")
+	multilevelMaxDepth, multilevelMaxDepthErr := parseInt("MULTILEVEL_MAX_DEPTH")
+
+	vestingDays, vestingDaysErr := parseInt("VESTING_DAYS")
+	vestingReports, vestingReportsErr := parseInt("VESTING_REPORTS")
+
 	return &Config{
 		PostgresDSN:             os.Getenv("POSTGRES_DSN"),
 		TelegramToken:           os.Getenv("TELEGRAM_TOKEN"),
 		Address:                 os.Getenv("STELLAR_ADDRESS"),
 		Seed:                    os.Getenv("STELLAR_SEED"),
+		HorizonURL:              horizonURL,
+		HorizonConcurrency:      horizonConcurrency,
+		HorizonReadRetries:      horizonReadRetries,
+		HorizonSubmitRetries:    horizonSubmitRetries,
+		NetworkPassphrase:       networkPassphrase,
+		Assets:                  assets,
 		ReportToChatID:          reportToChatID,
 		ReportToMessageThreadID: reportToMessageThreadID,
 		SwapPriceThreshold:      swapPriceThreshold,
 		AlertMentionUsername:    alertMentionUsername,
+		RewardPolicy:            os.Getenv("REWARD_POLICY"),
+		RewardTierWeights:       rewardTierWeights,
+		RewardNewMemberBonus:    rewardNewMemberBonus,
+		PayoutCap:               payoutCap,
+		PayoutCapShare:          payoutCapShare,
+		PayoutCapExcess:         payoutCapExcess,
+		MinPayout:               minPayout,
+		ArrearsExpiry:           time.Duration(arrearsExpiryDays) * 24 * time.Hour,
+		ClaimableBalancePeriod:  time.Duration(claimableBalanceDays) * 24 * time.Hour,
+		TransactionValidity:     time.Duration(transactionValidityHours) * time.Hour,
+		ConflictPolicy:          conflictPolicy,
+		RewardAssets:            rewardAssets,
+		MultilevelShares:        multilevelShares,
+		MultilevelMaxDepth:      multilevelMaxDepth,
+		VestingPeriod:           time.Duration(vestingDays) * 24 * time.Hour,
+		VestingReports:          vestingReports,
+		GraphPolicy: mlm.GraphPolicy{
+			SelfLoop: graphPolicy("GRAPH_SELF_LOOP_POLICY"),
+			Mutual:   graphPolicy("GRAPH_MUTUAL_POLICY"),
+			Cycle:    graphPolicy("GRAPH_CYCLE_POLICY"),
+		},
+		rewardAssetsErr: rewardAssetsErr,
+		assetsErr:       assetsErr,
+		parseErr: errors.Join(
+			rewardTierWeightsErr,
+			rewardNewMemberBonusErr,
+			payoutCapErr,
+			payoutCapShareErr,
+			minPayoutErr,
+			claimableBalanceDaysErr,
+			budgetErr,
+			multilevelSharesErr,
+			multilevelMaxDepthErr,
+			vestingDaysErr,
+			vestingReportsErr,
+		),
+	}
+}
+
+func isNotFinite(f float64) bool {
+	return math.IsNaN(f) || math.IsInf(f, 0)
+}
+
+// graphPolicy возвращает политику для нарушения в графе рекомендаций, по умолчанию flag
+func graphPolicy(key string) string {
+	if policy := os.Getenv(key); policy != "" {
+		return policy
+	}
+	return mlm.GraphPolicyFlag
+}
+
+// parseAssets читает активы MTLAP, EURMTL и LABR из MTLAP_ASSET, EURMTL_ASSET и LABR_ASSET
+// в формате CODE:ISSUER. Незаданные активы берутся из основной сети.
+func parseAssets() (stellar.Assets, error) {
+	assets := stellar.DefaultAssets()
+
+	for _, a := range []struct {
+		key   string
+		asset *mlm.Asset
+	}{
+		{"MTLAP_ASSET", &assets.MTLAP},
+		{"EURMTL_ASSET", &assets.EURMTL},
+		{"LABR_ASSET", &assets.LABR},
+	} {
+		s := strings.TrimSpace(os.Getenv(a.key))
+		if s == "" {
+			continue
+		}
+
+		code, issuer, ok := strings.Cut(s, ":")
+		if !ok || code == "" || issuer == "" {
+			return assets, fmt.Errorf("%s: %q: expected CODE:ISSUER", a.key, s)
+		}
+
+		*a.asset = mlm.Asset{Code: code, Issuer: issuer}
+	}
+
+	return assets, nil
+}
+
+// defaultRewardAsset возвращает LABR с политикой бюджета из BUDGET_* переменных
+func defaultRewardAsset(labr mlm.Asset) (RewardAsset, error) {
+	budgetPolicy := os.Getenv("BUDGET_POLICY")
+	if budgetPolicy == "" {
+		budgetPolicy = BudgetPolicyPercent
+	}
+
+	budgetAmount, budgetAmountErr := parseAmount("BUDGET_AMOUNT")
+	budgetReserve, budgetReserveErr := parseAmount("BUDGET_RESERVE")
+	budgetEUR, budgetEURErr := parseAmount("BUDGET_EUR")
+
+	budgetPercent := 100.0 / 3 // треть баланса
+	var budgetPercentErr error
+	if strings.TrimSpace(os.Getenv("BUDGET_PERCENT")) != "" {
+		budgetPercent, budgetPercentErr = parseFloat("BUDGET_PERCENT")
+	}
+
+	return RewardAsset{
+		Code:          labr.Code,
+		Issuer:        labr.Issuer,
+		BudgetPolicy:  budgetPolicy,
+		BudgetAmount:  budgetAmount,
+		BudgetPercent: budgetPercent,
+		BudgetReserve: budgetReserve,
+		BudgetEUR:     budgetEUR,
+	}, errors.Join(budgetAmountErr, budgetReserveErr, budgetEURErr, budgetPercentErr)
+}
+
+// parseRewardAssets разбирает список активов награды через запятую
+// в формате CODE:ISSUER:POLICY:VALUE, например LABR:GA7I...:percent:33.3,EURMTL:GACK...:fixed:100.
+// VALUE — процент для percent, сумма актива для fixed и reserve, сумма EUR для eur.
+func parseRewardAssets(s string) ([]RewardAsset, error) {
+	var res []RewardAsset
+
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("%q: expected CODE:ISSUER:POLICY:VALUE", part)
+		}
+
+		a := RewardAsset{
+			Code:         fields[0],
+			Issuer:       fields[1],
+			BudgetPolicy: fields[2],
+		}
+
+		var err error
+
+		switch a.BudgetPolicy {
+		case BudgetPolicyPercent:
+			a.BudgetPercent, err = strconv.ParseFloat(fields[3], 64)
+		case BudgetPolicyFixed:
+			a.BudgetAmount, err = amount.ParseInt64(fields[3])
+		case BudgetPolicyReserve:
+			a.BudgetReserve, err = amount.ParseInt64(fields[3])
+		case BudgetPolicyEUR:
+			a.BudgetEUR, err = amount.ParseInt64(fields[3])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", part, err)
+		}
+
+		// Повторный актив получил бы два бюджета с одного баланса
+		if slices.ContainsFunc(res, func(r RewardAsset) bool { return r.Code == a.Code && r.Issuer == a.Issuer }) {
+			return nil, fmt.Errorf("%q: duplicate asset %s:%s", part, a.Code, a.Issuer)
+		}
+
+		res = append(res, a)
+	}
+
+	return res, nil
+}
+
+// parseAmount читает сумму в строупах из переменной key, пустая переменная — 0
+func parseAmount(key string) (int64, error) {
+	s := strings.TrimSpace(os.Getenv(key))
+	if s == "" {
+		return 0, nil
+	}
+
+	v, err := amount.ParseInt64(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+
+	return v, nil
+}
+
+// parseFloat читает число из переменной key, пустая переменная — 0
+func parseFloat(key string) (float64, error) {
+	s := strings.TrimSpace(os.Getenv(key))
+	if s == "" {
+		return 0, nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %q is not a number", key, s)
+	}
+
+	return f, nil
+}
+
+// parseInt читает целое число из переменной key, пустая переменная — 0
+func parseInt(key string) (int, error) {
+	s := strings.TrimSpace(os.Getenv(key))
+	if s == "" {
+		return 0, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %q is not an integer", key, s)
 	}
+
+	return v, nil
+}
+
+// parseFloats разбирает список чисел через запятую из переменной key.
+// Некорректное значение — ошибка: пропуск сдвинул бы следующие значения на уровень ниже.
+func parseFloats(key string) ([]float64, error) {
+	s := os.Getenv(key)
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var res []float64
+
+	for _, part := range strings.Split(s, ",") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not a number", key, part)
+		}
+		res = append(res, f)
+	}
+
+	return res, nil
 }
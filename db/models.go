@@ -8,26 +8,66 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type Arrear struct {
+	ReportID    int64
+	Recommender string
+	Asset       string
+	Amount      int64
+	CreatedAt   pgtype.Timestamptz
+	Issuer      string
+}
+
+type Carryover struct {
+	ReportID    int64
+	Recommender pgtype.Text
+	Amount      pgtype.Numeric
+	Asset       string
+	Issuer      string
+}
+
+type ConflictResolution struct {
+	Recommended string
+	Recommender string
+	CreatedAt   pgtype.Timestamptz
+}
+
+type Exclusion struct {
+	AccountID string
+	Reason    string
+	Author    string
+	ExpiresAt pgtype.Timestamptz
+	CreatedAt pgtype.Timestamptz
+}
+
 type Report struct {
 	ID        int64
 	CreatedAt pgtype.Timestamptz
 	DeletedAt pgtype.Timestamptz
-	Xdr       string
-	Hash      pgtype.Text
 	UpdatedAt pgtype.Timestamptz
+	Budget    []byte
 }
 
 type ReportConflict struct {
 	ReportID    int64
 	Recommender string
 	Recommended string
+	Resolution  string
 }
 
 type ReportDistribute struct {
 	ReportID    int64
 	Recommender string
 	Asset       string
-	Amount      float64
+	Amount      int64
+	Capped      int64
+	Claimable   bool
+	Issuer      string
+}
+
+type ReportExclusion struct {
+	ReportID  int64
+	AccountID string
+	Reason    string
 }
 
 type ReportRecommend struct {
@@ -37,6 +77,23 @@ type ReportRecommend struct {
 	RecommendedMtlap int64
 }
 
+type ReportSnapshot struct {
+	ReportID  int64
+	Ledger    int64
+	Accounts  []byte
+	CreatedAt pgtype.Timestamptz
+}
+
+type ReportTransaction struct {
+	ReportID  int64
+	Chunk     int32
+	Xdr       string
+	Hash      pgtype.Text
+	UpdatedAt pgtype.Timestamptz
+	Status    string
+	SignedXdr pgtype.Text
+}
+
 type State struct {
 	UserID    int64
 	State     string
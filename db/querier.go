@@ -9,22 +9,45 @@ import (
 )
 
 type Querier interface {
-	CreateReport(ctx context.Context, xdr string) (int64, error)
+	CreateArrear(ctx context.Context, arg CreateArrearParams) error
+	CreateCarryover(ctx context.Context, arg CreateCarryoverParams) error
+	CreateReport(ctx context.Context, budget []byte) (int64, error)
 	CreateReportConflict(ctx context.Context, arg CreateReportConflictParams) error
 	CreateReportDistribute(ctx context.Context, arg CreateReportDistributeParams) error
+	CreateReportExclusion(ctx context.Context, arg CreateReportExclusionParams) error
 	CreateReportRecommend(ctx context.Context, arg CreateReportRecommendParams) error
+	CreateReportSnapshot(ctx context.Context, arg CreateReportSnapshotParams) error
+	CreateReportTransaction(ctx context.Context, arg CreateReportTransactionParams) error
 	CreateState(ctx context.Context, arg CreateStateParams) error
+	DeleteExclusion(ctx context.Context, accountID string) (int64, error)
 	DeleteReport(ctx context.Context, id int64) error
+	GetActiveExclusions(ctx context.Context) ([]Exclusion, error)
+	GetArrears(ctx context.Context, reportID int64) ([]Arrear, error)
+	GetCarryover(ctx context.Context, reportID int64) ([]Carryover, error)
+	GetConflictResolutions(ctx context.Context) ([]ConflictResolution, error)
+	GetExclusions(ctx context.Context) ([]Exclusion, error)
+	GetFirstRecommendations(ctx context.Context, arg GetFirstRecommendationsParams) ([]GetFirstRecommendationsRow, error)
+	GetLastPaidReport(ctx context.Context, beforeReportID int64) (Report, error)
+	GetLatestSnapshotReport(ctx context.Context, arg GetLatestSnapshotReportParams) (Report, error)
+	GetMTLAPHighWaterMarks(ctx context.Context, beforeReportID int64) ([]GetMTLAPHighWaterMarksRow, error)
 	GetPendingReport(ctx context.Context) (Report, error)
 	GetReport(ctx context.Context, id int64) (Report, error)
 	GetReportConflicts(ctx context.Context, reportID int64) ([]ReportConflict, error)
 	GetReportDistributes(ctx context.Context, reportID int64) ([]ReportDistribute, error)
+	GetReportExclusions(ctx context.Context, reportID int64) ([]ReportExclusion, error)
 	GetReportRecommends(ctx context.Context, reportID int64) ([]ReportRecommend, error)
+	GetReportSnapshot(ctx context.Context, reportID int64) (ReportSnapshot, error)
+	GetReportTransactions(ctx context.Context, reportID int64) ([]ReportTransaction, error)
 	GetReports(ctx context.Context, queryLimit int32) ([]Report, error)
 	GetState(ctx context.Context, userID int64) (State, error)
+	GetVestingSnapshots(ctx context.Context, arg GetVestingSnapshotsParams) ([]ReportSnapshot, error)
 	LockReport(ctx context.Context) error
-	SetReportHash(ctx context.Context, arg SetReportHashParams) error
+	SetConflictResolution(ctx context.Context, arg SetConflictResolutionParams) error
+	SetExclusion(ctx context.Context, arg SetExclusionParams) error
+	SetReportTransactionSignedXDR(ctx context.Context, arg SetReportTransactionSignedXDRParams) error
+	SetReportTransactionStatus(ctx context.Context, arg SetReportTransactionStatusParams) error
 	UnlockReport(ctx context.Context) error
+	UpdateReportTransactionXDR(ctx context.Context, arg UpdateReportTransactionXDRParams) error
 }
 
 var _ Querier = (*Queries)(nil)
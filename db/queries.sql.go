@@ -11,44 +11,103 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const createArrear = `-- name: CreateArrear :exec
+INSERT INTO arrears (report_id, recommender, asset, issuer, amount, created_at)
+  VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+type CreateArrearParams struct {
+	ReportID    int64
+	Recommender string
+	Asset       string
+	Issuer      string
+	Amount      int64
+	CreatedAt   pgtype.Timestamptz
+}
+
+func (q *Queries) CreateArrear(ctx context.Context, arg CreateArrearParams) error {
+	_, err := q.db.Exec(ctx, createArrear,
+		arg.ReportID,
+		arg.Recommender,
+		arg.Asset,
+		arg.Issuer,
+		arg.Amount,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+const createCarryover = `-- name: CreateCarryover :exec
+INSERT INTO carryover (report_id, recommender, asset, issuer, amount)
+  VALUES ($1, $2, $3, $4, $5)
+`
+
+type CreateCarryoverParams struct {
+	ReportID    int64
+	Recommender pgtype.Text
+	Asset       string
+	Issuer      string
+	Amount      pgtype.Numeric
+}
+
+func (q *Queries) CreateCarryover(ctx context.Context, arg CreateCarryoverParams) error {
+	_, err := q.db.Exec(ctx, createCarryover,
+		arg.ReportID,
+		arg.Recommender,
+		arg.Asset,
+		arg.Issuer,
+		arg.Amount,
+	)
+	return err
+}
+
 const createReport = `-- name: CreateReport :one
-INSERT INTO reports (created_at, xdr)
+INSERT INTO reports (created_at, budget)
   VALUES (now(), $1) RETURNING id
 `
 
-func (q *Queries) CreateReport(ctx context.Context, xdr string) (int64, error) {
-	row := q.db.QueryRow(ctx, createReport, xdr)
+func (q *Queries) CreateReport(ctx context.Context, budget []byte) (int64, error) {
+	row := q.db.QueryRow(ctx, createReport, budget)
 	var id int64
 	err := row.Scan(&id)
 	return id, err
 }
 
 const createReportConflict = `-- name: CreateReportConflict :exec
-INSERT INTO report_conflicts (report_id, recommender, recommended)
-  VALUES ($1, $2, $3)
+INSERT INTO report_conflicts (report_id, recommender, recommended, resolution)
+  VALUES ($1, $2, $3, $4)
 `
 
 type CreateReportConflictParams struct {
 	ReportID    int64
 	Recommender string
 	Recommended string
+	Resolution  string
 }
 
 func (q *Queries) CreateReportConflict(ctx context.Context, arg CreateReportConflictParams) error {
-	_, err := q.db.Exec(ctx, createReportConflict, arg.ReportID, arg.Recommender, arg.Recommended)
+	_, err := q.db.Exec(ctx, createReportConflict,
+		arg.ReportID,
+		arg.Recommender,
+		arg.Recommended,
+		arg.Resolution,
+	)
 	return err
 }
 
 const createReportDistribute = `-- name: CreateReportDistribute :exec
-INSERT INTO report_distributes (report_id, recommender, asset, amount)
-  VALUES ($1, $2, $3, $4)
+INSERT INTO report_distributes (report_id, recommender, asset, issuer, amount, capped, claimable)
+  VALUES ($1, $2, $3, $4, $5, $6, $7)
 `
 
 type CreateReportDistributeParams struct {
 	ReportID    int64
 	Recommender string
 	Asset       string
-	Amount      float64
+	Issuer      string
+	Amount      int64
+	Capped      int64
+	Claimable   bool
 }
 
 func (q *Queries) CreateReportDistribute(ctx context.Context, arg CreateReportDistributeParams) error {
@@ -56,11 +115,30 @@ func (q *Queries) CreateReportDistribute(ctx context.Context, arg CreateReportDi
 		arg.ReportID,
 		arg.Recommender,
 		arg.Asset,
+		arg.Issuer,
 		arg.Amount,
+		arg.Capped,
+		arg.Claimable,
 	)
 	return err
 }
 
+const createReportExclusion = `-- name: CreateReportExclusion :exec
+INSERT INTO report_exclusions (report_id, account_id, reason)
+  VALUES ($1, $2, $3)
+`
+
+type CreateReportExclusionParams struct {
+	ReportID  int64
+	AccountID string
+	Reason    string
+}
+
+func (q *Queries) CreateReportExclusion(ctx context.Context, arg CreateReportExclusionParams) error {
+	_, err := q.db.Exec(ctx, createReportExclusion, arg.ReportID, arg.AccountID, arg.Reason)
+	return err
+}
+
 const createReportRecommend = `-- name: CreateReportRecommend :exec
 INSERT INTO report_recommends (report_id, recommender, recommended, recommended_mtlap)
   VALUES ($1, $2, $3, $4)
@@ -83,6 +161,38 @@ func (q *Queries) CreateReportRecommend(ctx context.Context, arg CreateReportRec
 	return err
 }
 
+const createReportSnapshot = `-- name: CreateReportSnapshot :exec
+INSERT INTO report_snapshots (report_id, ledger, accounts, created_at)
+  VALUES ($1, $2, $3, now())
+`
+
+type CreateReportSnapshotParams struct {
+	ReportID int64
+	Ledger   int64
+	Accounts []byte
+}
+
+func (q *Queries) CreateReportSnapshot(ctx context.Context, arg CreateReportSnapshotParams) error {
+	_, err := q.db.Exec(ctx, createReportSnapshot, arg.ReportID, arg.Ledger, arg.Accounts)
+	return err
+}
+
+const createReportTransaction = `-- name: CreateReportTransaction :exec
+INSERT INTO report_transactions (report_id, chunk, xdr)
+  VALUES ($1, $2, $3)
+`
+
+type CreateReportTransactionParams struct {
+	ReportID int64
+	Chunk    int32
+	Xdr      string
+}
+
+func (q *Queries) CreateReportTransaction(ctx context.Context, arg CreateReportTransactionParams) error {
+	_, err := q.db.Exec(ctx, createReportTransaction, arg.ReportID, arg.Chunk, arg.Xdr)
+	return err
+}
+
 const createState = `-- name: CreateState :exec
 INSERT INTO states (user_id, state, data, meta, created_at)
   VALUES ($1, $2, $3, $4, now())
@@ -105,6 +215,19 @@ func (q *Queries) CreateState(ctx context.Context, arg CreateStateParams) error
 	return err
 }
 
+const deleteExclusion = `-- name: DeleteExclusion :execrows
+DELETE FROM exclusions
+WHERE account_id = $1
+`
+
+func (q *Queries) DeleteExclusion(ctx context.Context, accountID string) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExclusion, accountID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const deleteReport = `-- name: DeleteReport :exec
 UPDATE reports
 SET deleted_at = now()
@@ -116,12 +239,304 @@ func (q *Queries) DeleteReport(ctx context.Context, id int64) error {
 	return err
 }
 
+const getActiveExclusions = `-- name: GetActiveExclusions :many
+SELECT account_id, reason, author, expires_at, created_at FROM exclusions
+WHERE expires_at IS NULL OR expires_at > now()
+ORDER BY account_id
+`
+
+func (q *Queries) GetActiveExclusions(ctx context.Context) ([]Exclusion, error) {
+	rows, err := q.db.Query(ctx, getActiveExclusions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Exclusion
+	for rows.Next() {
+		var i Exclusion
+		if err := rows.Scan(
+			&i.AccountID,
+			&i.Reason,
+			&i.Author,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getArrears = `-- name: GetArrears :many
+SELECT report_id, recommender, asset, amount, created_at, issuer FROM arrears
+WHERE report_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetArrears(ctx context.Context, reportID int64) ([]Arrear, error) {
+	rows, err := q.db.Query(ctx, getArrears, reportID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Arrear
+	for rows.Next() {
+		var i Arrear
+		if err := rows.Scan(
+			&i.ReportID,
+			&i.Recommender,
+			&i.Asset,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.Issuer,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getCarryover = `-- name: GetCarryover :many
+SELECT report_id, recommender, amount, asset, issuer FROM carryover
+WHERE report_id = $1
+`
+
+func (q *Queries) GetCarryover(ctx context.Context, reportID int64) ([]Carryover, error) {
+	rows, err := q.db.Query(ctx, getCarryover, reportID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Carryover
+	for rows.Next() {
+		var i Carryover
+		if err := rows.Scan(
+			&i.ReportID,
+			&i.Recommender,
+			&i.Amount,
+			&i.Asset,
+			&i.Issuer,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getConflictResolutions = `-- name: GetConflictResolutions :many
+SELECT recommended, recommender, created_at FROM conflict_resolutions
+`
+
+func (q *Queries) GetConflictResolutions(ctx context.Context) ([]ConflictResolution, error) {
+	rows, err := q.db.Query(ctx, getConflictResolutions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ConflictResolution
+	for rows.Next() {
+		var i ConflictResolution
+		if err := rows.Scan(&i.Recommended, &i.Recommender, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getExclusions = `-- name: GetExclusions :many
+SELECT account_id, reason, author, expires_at, created_at FROM exclusions
+ORDER BY created_at
+`
+
+func (q *Queries) GetExclusions(ctx context.Context) ([]Exclusion, error) {
+	rows, err := q.db.Query(ctx, getExclusions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Exclusion
+	for rows.Next() {
+		var i Exclusion
+		if err := rows.Scan(
+			&i.AccountID,
+			&i.Reason,
+			&i.Author,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFirstRecommendations = `-- name: GetFirstRecommendations :many
+SELECT rr.recommender, rr.recommended, min(r.created_at)::timestamptz AS first_at
+FROM report_recommends rr
+JOIN reports r ON r.id = rr.report_id
+WHERE r.deleted_at IS NULL
+  AND ($1::bigint = 0::bigint OR r.id < $1)
+  AND rr.recommended = ANY($2::text[])
+GROUP BY rr.recommender, rr.recommended
+`
+
+type GetFirstRecommendationsParams struct {
+	BeforeReportID int64
+	Recommended    []string
+}
+
+type GetFirstRecommendationsRow struct {
+	Recommender string
+	Recommended string
+	FirstAt     pgtype.Timestamptz
+}
+
+func (q *Queries) GetFirstRecommendations(ctx context.Context, arg GetFirstRecommendationsParams) ([]GetFirstRecommendationsRow, error) {
+	rows, err := q.db.Query(ctx, getFirstRecommendations, arg.BeforeReportID, arg.Recommended)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFirstRecommendationsRow
+	for rows.Next() {
+		var i GetFirstRecommendationsRow
+		if err := rows.Scan(&i.Recommender, &i.Recommended, &i.FirstAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLastPaidReport = `-- name: GetLastPaidReport :one
+SELECT r.id, r.created_at, r.deleted_at, r.updated_at, r.budget FROM reports r
+WHERE r.deleted_at IS NULL
+  AND ($1::bigint = 0::bigint OR r.id < $1)
+  AND EXISTS (
+    SELECT 1 FROM report_transactions t
+    WHERE t.report_id = r.id AND t.status = 'success'
+  )
+ORDER BY r.id DESC
+LIMIT 1
+`
+
+func (q *Queries) GetLastPaidReport(ctx context.Context, beforeReportID int64) (Report, error) {
+	row := q.db.QueryRow(ctx, getLastPaidReport, beforeReportID)
+	var i Report
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.UpdatedAt,
+		&i.Budget,
+	)
+	return i, err
+}
+
+const getLatestSnapshotReport = `-- name: GetLatestSnapshotReport :one
+SELECT r.id, r.created_at, r.deleted_at, r.updated_at, r.budget FROM reports r
+JOIN report_snapshots s ON s.report_id = r.id
+WHERE r.deleted_at IS NULL
+  AND ($1::bigint = 0::bigint OR r.id < $1)
+  AND r.created_at <= $2::timestamptz
+ORDER BY r.id DESC
+LIMIT 1
+`
+
+type GetLatestSnapshotReportParams struct {
+	BeforeReportID int64
+	CreatedAt      pgtype.Timestamptz
+}
+
+func (q *Queries) GetLatestSnapshotReport(ctx context.Context, arg GetLatestSnapshotReportParams) (Report, error) {
+	row := q.db.QueryRow(ctx, getLatestSnapshotReport, arg.BeforeReportID, arg.CreatedAt)
+	var i Report
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.UpdatedAt,
+		&i.Budget,
+	)
+	return i, err
+}
+
+const getMTLAPHighWaterMarks = `-- name: GetMTLAPHighWaterMarks :many
+SELECT rr.recommended, max(rr.recommended_mtlap)::bigint AS mtlap
+FROM report_recommends rr
+JOIN reports r ON r.id = rr.report_id
+WHERE r.deleted_at IS NULL
+  AND ($1::bigint = 0::bigint OR r.id < $1)
+  AND EXISTS (
+    SELECT 1 FROM report_transactions t
+    WHERE t.report_id = r.id AND t.status = 'success'
+  )
+GROUP BY rr.recommended
+`
+
+type GetMTLAPHighWaterMarksRow struct {
+	Recommended string
+	Mtlap       int64
+}
+
+func (q *Queries) GetMTLAPHighWaterMarks(ctx context.Context, beforeReportID int64) ([]GetMTLAPHighWaterMarksRow, error) {
+	rows, err := q.db.Query(ctx, getMTLAPHighWaterMarks, beforeReportID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetMTLAPHighWaterMarksRow
+	for rows.Next() {
+		var i GetMTLAPHighWaterMarksRow
+		if err := rows.Scan(&i.Recommended, &i.Mtlap); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getPendingReport = `-- name: GetPendingReport :one
-SELECT id, created_at, deleted_at, xdr, hash, updated_at FROM reports
-WHERE deleted_at IS NULL
-  AND hash IS NULL
-  AND created_at > now() - interval '24 hours'
-ORDER BY created_at DESC
+SELECT r.id, r.created_at, r.deleted_at, r.updated_at, r.budget FROM reports r
+WHERE r.deleted_at IS NULL
+  AND EXISTS (
+    SELECT 1 FROM report_transactions t
+    WHERE t.report_id = r.id AND t.status <> 'success'
+  )
+  AND (
+    r.created_at > now() - interval '24 hours'
+    OR EXISTS (
+      SELECT 1 FROM report_transactions t
+      WHERE t.report_id = r.id AND t.status IN ('success', 'unknown')
+    )
+  )
+ORDER BY r.created_at DESC
 LIMIT 1
 `
 
@@ -132,15 +547,14 @@ func (q *Queries) GetPendingReport(ctx context.Context) (Report, error) {
 		&i.ID,
 		&i.CreatedAt,
 		&i.DeletedAt,
-		&i.Xdr,
-		&i.Hash,
 		&i.UpdatedAt,
+		&i.Budget,
 	)
 	return i, err
 }
 
 const getReport = `-- name: GetReport :one
-SELECT id, created_at, deleted_at, xdr, hash, updated_at FROM reports
+SELECT id, created_at, deleted_at, updated_at, budget FROM reports
 WHERE deleted_at IS NULL AND
   id = $1
 `
@@ -152,15 +566,14 @@ func (q *Queries) GetReport(ctx context.Context, id int64) (Report, error) {
 		&i.ID,
 		&i.CreatedAt,
 		&i.DeletedAt,
-		&i.Xdr,
-		&i.Hash,
 		&i.UpdatedAt,
+		&i.Budget,
 	)
 	return i, err
 }
 
 const getReportConflicts = `-- name: GetReportConflicts :many
-SELECT report_id, recommender, recommended FROM report_conflicts
+SELECT report_id, recommender, recommended, resolution FROM report_conflicts
 WHERE report_id = $1
 `
 
@@ -173,7 +586,12 @@ func (q *Queries) GetReportConflicts(ctx context.Context, reportID int64) ([]Rep
 	var items []ReportConflict
 	for rows.Next() {
 		var i ReportConflict
-		if err := rows.Scan(&i.ReportID, &i.Recommender, &i.Recommended); err != nil {
+		if err := rows.Scan(
+			&i.ReportID,
+			&i.Recommender,
+			&i.Recommended,
+			&i.Resolution,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -185,7 +603,7 @@ func (q *Queries) GetReportConflicts(ctx context.Context, reportID int64) ([]Rep
 }
 
 const getReportDistributes = `-- name: GetReportDistributes :many
-SELECT report_id, recommender, asset, amount FROM report_distributes
+SELECT report_id, recommender, asset, amount, capped, claimable, issuer FROM report_distributes
 WHERE report_id = $1
 `
 
@@ -203,6 +621,9 @@ func (q *Queries) GetReportDistributes(ctx context.Context, reportID int64) ([]R
 			&i.Recommender,
 			&i.Asset,
 			&i.Amount,
+			&i.Capped,
+			&i.Claimable,
+			&i.Issuer,
 		); err != nil {
 			return nil, err
 		}
@@ -214,6 +635,32 @@ func (q *Queries) GetReportDistributes(ctx context.Context, reportID int64) ([]R
 	return items, nil
 }
 
+const getReportExclusions = `-- name: GetReportExclusions :many
+SELECT report_id, account_id, reason FROM report_exclusions
+WHERE report_id = $1
+ORDER BY account_id
+`
+
+func (q *Queries) GetReportExclusions(ctx context.Context, reportID int64) ([]ReportExclusion, error) {
+	rows, err := q.db.Query(ctx, getReportExclusions, reportID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ReportExclusion
+	for rows.Next() {
+		var i ReportExclusion
+		if err := rows.Scan(&i.ReportID, &i.AccountID, &i.Reason); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getReportRecommends = `-- name: GetReportRecommends :many
 SELECT report_id, recommender, recommended, recommended_mtlap FROM report_recommends
 WHERE report_id = $1
@@ -244,8 +691,59 @@ func (q *Queries) GetReportRecommends(ctx context.Context, reportID int64) ([]Re
 	return items, nil
 }
 
+const getReportSnapshot = `-- name: GetReportSnapshot :one
+SELECT report_id, ledger, accounts, created_at FROM report_snapshots
+WHERE report_id = $1
+`
+
+func (q *Queries) GetReportSnapshot(ctx context.Context, reportID int64) (ReportSnapshot, error) {
+	row := q.db.QueryRow(ctx, getReportSnapshot, reportID)
+	var i ReportSnapshot
+	err := row.Scan(
+		&i.ReportID,
+		&i.Ledger,
+		&i.Accounts,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getReportTransactions = `-- name: GetReportTransactions :many
+SELECT report_id, chunk, xdr, hash, updated_at, status, signed_xdr FROM report_transactions
+WHERE report_id = $1
+ORDER BY chunk
+`
+
+func (q *Queries) GetReportTransactions(ctx context.Context, reportID int64) ([]ReportTransaction, error) {
+	rows, err := q.db.Query(ctx, getReportTransactions, reportID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ReportTransaction
+	for rows.Next() {
+		var i ReportTransaction
+		if err := rows.Scan(
+			&i.ReportID,
+			&i.Chunk,
+			&i.Xdr,
+			&i.Hash,
+			&i.UpdatedAt,
+			&i.Status,
+			&i.SignedXdr,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getReports = `-- name: GetReports :many
-SELECT id, created_at, deleted_at, xdr, hash, updated_at FROM reports
+SELECT id, created_at, deleted_at, updated_at, budget FROM reports
 WHERE deleted_at IS NULL
 ORDER BY created_at DESC
 LIMIT nullif($1::int, 0)
@@ -264,9 +762,8 @@ func (q *Queries) GetReports(ctx context.Context, queryLimit int32) ([]Report, e
 			&i.ID,
 			&i.CreatedAt,
 			&i.DeletedAt,
-			&i.Xdr,
-			&i.Hash,
 			&i.UpdatedAt,
+			&i.Budget,
 		); err != nil {
 			return nil, err
 		}
@@ -298,6 +795,47 @@ func (q *Queries) GetState(ctx context.Context, userID int64) (State, error) {
 	return i, err
 }
 
+const getVestingSnapshots = `-- name: GetVestingSnapshots :many
+SELECT s.report_id, s.ledger, s.accounts, s.created_at FROM report_snapshots s
+JOIN reports r ON r.id = s.report_id
+WHERE r.deleted_at IS NULL
+  AND ($1::bigint = 0::bigint OR r.id < $1)
+  AND r.created_at >= $2::timestamptz
+ORDER BY r.id DESC
+LIMIT $3
+`
+
+type GetVestingSnapshotsParams struct {
+	BeforeReportID int64
+	Since          pgtype.Timestamptz
+	QueryLimit     int32
+}
+
+func (q *Queries) GetVestingSnapshots(ctx context.Context, arg GetVestingSnapshotsParams) ([]ReportSnapshot, error) {
+	rows, err := q.db.Query(ctx, getVestingSnapshots, arg.BeforeReportID, arg.Since, arg.QueryLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ReportSnapshot
+	for rows.Next() {
+		var i ReportSnapshot
+		if err := rows.Scan(
+			&i.ReportID,
+			&i.Ledger,
+			&i.Accounts,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const lockReport = `-- name: LockReport :exec
 SELECT pg_advisory_lock(1)
 `
@@ -307,20 +845,93 @@ func (q *Queries) LockReport(ctx context.Context) error {
 	return err
 }
 
-const setReportHash = `-- name: SetReportHash :exec
-UPDATE reports
+const setConflictResolution = `-- name: SetConflictResolution :exec
+INSERT INTO conflict_resolutions (recommended, recommender, created_at)
+  VALUES ($1, $2, now())
+ON CONFLICT (recommended) DO UPDATE
+SET recommender = excluded.recommender,
+  created_at = excluded.created_at
+`
+
+type SetConflictResolutionParams struct {
+	Recommended string
+	Recommender string
+}
+
+func (q *Queries) SetConflictResolution(ctx context.Context, arg SetConflictResolutionParams) error {
+	_, err := q.db.Exec(ctx, setConflictResolution, arg.Recommended, arg.Recommender)
+	return err
+}
+
+const setExclusion = `-- name: SetExclusion :exec
+INSERT INTO exclusions (account_id, reason, author, expires_at, created_at)
+  VALUES ($1, $2, $3, $4, now())
+ON CONFLICT (account_id) DO UPDATE
+SET reason = excluded.reason,
+  author = excluded.author,
+  expires_at = excluded.expires_at,
+  created_at = excluded.created_at
+`
+
+type SetExclusionParams struct {
+	AccountID string
+	Reason    string
+	Author    string
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) SetExclusion(ctx context.Context, arg SetExclusionParams) error {
+	_, err := q.db.Exec(ctx, setExclusion,
+		arg.AccountID,
+		arg.Reason,
+		arg.Author,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const setReportTransactionSignedXDR = `-- name: SetReportTransactionSignedXDR :exec
+UPDATE report_transactions
+SET signed_xdr = $1,
+  updated_at = now()
+WHERE report_id = $2
+  AND chunk = $3
+`
+
+type SetReportTransactionSignedXDRParams struct {
+	SignedXdr pgtype.Text
+	ReportID  int64
+	Chunk     int32
+}
+
+func (q *Queries) SetReportTransactionSignedXDR(ctx context.Context, arg SetReportTransactionSignedXDRParams) error {
+	_, err := q.db.Exec(ctx, setReportTransactionSignedXDR, arg.SignedXdr, arg.ReportID, arg.Chunk)
+	return err
+}
+
+const setReportTransactionStatus = `-- name: SetReportTransactionStatus :exec
+UPDATE report_transactions
 SET hash = $1,
+  status = $2,
   updated_at = now()
-WHERE id = $2
+WHERE report_id = $3
+  AND chunk = $4
 `
 
-type SetReportHashParams struct {
+type SetReportTransactionStatusParams struct {
 	Hash     pgtype.Text
+	Status   string
 	ReportID int64
+	Chunk    int32
 }
 
-func (q *Queries) SetReportHash(ctx context.Context, arg SetReportHashParams) error {
-	_, err := q.db.Exec(ctx, setReportHash, arg.Hash, arg.ReportID)
+func (q *Queries) SetReportTransactionStatus(ctx context.Context, arg SetReportTransactionStatusParams) error {
+	_, err := q.db.Exec(ctx, setReportTransactionStatus,
+		arg.Hash,
+		arg.Status,
+		arg.ReportID,
+		arg.Chunk,
+	)
 	return err
 }
 
@@ -332,3 +943,25 @@ func (q *Queries) UnlockReport(ctx context.Context) error {
 	_, err := q.db.Exec(ctx, unlockReport)
 	return err
 }
+
+const updateReportTransactionXDR = `-- name: UpdateReportTransactionXDR :exec
+UPDATE report_transactions
+SET xdr = $1,
+  signed_xdr = NULL,
+  hash = NULL,
+  status = 'pending',
+  updated_at = now()
+WHERE report_id = $2
+  AND chunk = $3
+`
+
+type UpdateReportTransactionXDRParams struct {
+	Xdr      string
+	ReportID int64
+	Chunk    int32
+}
+
+func (q *Queries) UpdateReportTransactionXDR(ctx context.Context, arg UpdateReportTransactionXDRParams) error {
+	_, err := q.db.Exec(ctx, updateReportTransactionXDR, arg.Xdr, arg.ReportID, arg.Chunk)
+	return err
+}
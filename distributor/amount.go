@@ -0,0 +1,41 @@
+package distributor
+
+import (
+	"math/big"
+	"strconv"
+)
+
+// Все суммы считаются в строупах (int64) без плавающей точки, доли бюджета
+// вычисляются точно в рациональных числах с округлением вниз.
+
+// mulDiv возвращает floor(a * b / c) без переполнения
+func mulDiv(a, b, c int64) int64 {
+	if c == 0 {
+		return 0
+	}
+
+	res := new(big.Int).Mul(big.NewInt(a), big.NewInt(b))
+	res.Div(res, big.NewInt(c))
+
+	return res.Int64()
+}
+
+// mulRat возвращает floor(a * r)
+func mulRat(a int64, r *big.Rat) int64 {
+	return floorRat(new(big.Rat).Mul(new(big.Rat).SetInt64(a), r))
+}
+
+// floorRat округляет дробь вниз до целого
+func floorRat(r *big.Rat) int64 {
+	return new(big.Int).Div(r.Num(), r.Denom()).Int64()
+}
+
+// ratFromFloat переводит число из конфигурации в точную дробь по его десятичной записи,
+// чтобы 0.2 было ровно 1/5, а не ближайшим двоичным значением
+func ratFromFloat(f float64) *big.Rat {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	if !ok {
+		return new(big.Rat)
+	}
+	return r
+}
@@ -0,0 +1,195 @@
+package distributor
+
+import (
+	"context"
+	"math"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/db"
+	"github.com/samber/lo"
+)
+
+// getArrears возвращает удержанные выплаты, не выплаченные к последнему выплаченному отчету
+func (d *Distributor) getArrears(ctx context.Context) ([]mlm.Arrear, error) {
+	reportID, err := d.lastPaidReport(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if reportID == 0 {
+		return nil, nil
+	}
+
+	rows, err := d.q.GetArrears(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ArrearsFromRows(rows), nil
+}
+
+// ArrearsFromRows переводит записи журнала долгов в mlm.Arrear
+func ArrearsFromRows(rows []db.Arrear) []mlm.Arrear {
+	return lo.Map(rows, func(row db.Arrear, _ int) mlm.Arrear {
+		return mlm.Arrear{
+			AccountID: row.Recommender,
+			Asset:     mlm.Asset{Code: row.Asset, Issuer: row.Issuer},
+			Amount:    row.Amount,
+			CreatedAt: row.CreatedAt.Time,
+		}
+	})
+}
+
+// trustline — линия доверия счета к активу
+type trustline struct {
+	accountID string
+	asset     mlm.Asset
+}
+
+// applyArrears убирает из выплат счета без линии доверия, сохраняя их награду как долг,
+// и выплачивает прошлые долги тем, кто линию доверия открыл. Долги старше ArrearsExpiry списываются.
+// Если включены claimable balance, счета без линии доверия получают награду и долги через них.
+// Линии доверия проверяются для каждого актива отдельно. Выплата вместе с долгами
+// не превышает лимит выплаты актива: часть долга сверх лимита остается долгом
+// с прежней датой и выплачивается в следующих отчетах.
+func (d *Distributor) applyArrears(ctx context.Context, res *mlm.DistributeResult, arrears []mlm.Arrear) error {
+	missing := lo.SliceToMap(res.MissingTrustlines, func(mt mlm.MissingTrustline) (trustline, struct{}) {
+		return trustline{mt.AccountID, mt.Asset}, struct{}{}
+	})
+
+	res.Arrears = make([]mlm.Arrear, 0)
+	res.ArrearsPaid = make([]mlm.Arrear, 0)
+	res.ArrearsExpired = make([]mlm.Arrear, 0)
+
+	claimable := d.cfg.ClaimableBalancePeriod > 0
+
+	excluded := lo.SliceToMap(res.Exclusions, func(e db.ReportExclusion) (string, struct{}) {
+		return e.AccountID, struct{}{}
+	})
+
+	res.Distributes = lo.Filter(res.Distributes, func(dist db.ReportDistribute, _ int) bool {
+		asset := mlm.Asset{Code: dist.Asset, Issuer: dist.Issuer}
+
+		if _, ok := missing[trustline{dist.Recommender, asset}]; !ok || claimable {
+			return true
+		}
+
+		res.Arrears = append(res.Arrears, mlm.Arrear{
+			AccountID: dist.Recommender,
+			Asset:     asset,
+			Amount:    dist.Amount,
+			CreatedAt: res.CreatedAt,
+		})
+
+		return false
+	})
+
+	var keys []trustline
+	for _, a := range arrears {
+		key := trustline{a.AccountID, a.Asset}
+		if _, ok := excluded[a.AccountID]; ok {
+			continue
+		}
+		if _, ok := missing[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	has, err := d.lookupTrustlines(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range arrears {
+		// Долги исключенным не выплачиваются, но и не списываются до снятия исключения
+		if _, ok := excluded[a.AccountID]; ok {
+			res.Arrears = append(res.Arrears, a)
+			continue
+		}
+
+		hasTrustline := false
+
+		key := trustline{a.AccountID, a.Asset}
+
+		if _, ok := missing[key]; !ok {
+			if !has[key] {
+				missing[key] = struct{}{}
+			}
+			hasTrustline = has[key]
+		}
+
+		switch {
+		case hasTrustline || claimable:
+			paid := min(a.Amount, arrearsHeadroom(res, a.AccountID, a.Asset))
+			if paid > 0 {
+				res.ArrearsPaid = append(res.ArrearsPaid, mlm.Arrear{AccountID: a.AccountID, Asset: a.Asset, Amount: paid, CreatedAt: a.CreatedAt})
+				addDistribute(res, a.AccountID, a.Asset, paid)
+			}
+			if rest := a.Amount - paid; rest > 0 {
+				res.Arrears = append(res.Arrears, mlm.Arrear{AccountID: a.AccountID, Asset: a.Asset, Amount: rest, CreatedAt: a.CreatedAt})
+			}
+		case d.cfg.ArrearsExpiry > 0 && a.CreatedAt.Add(d.cfg.ArrearsExpiry).Before(res.CreatedAt):
+			res.ArrearsExpired = append(res.ArrearsExpired, a)
+		default:
+			res.Arrears = append(res.Arrears, a)
+		}
+	}
+
+	if claimable {
+		for i, dist := range res.Distributes {
+			_, res.Distributes[i].Claimable = missing[trustline{dist.Recommender, mlm.Asset{Code: dist.Asset, Issuer: dist.Issuer}}]
+		}
+	}
+
+	return nil
+}
+
+func (d *Distributor) createArrears(ctx context.Context, q *db.Queries, reportID int64, arrears []mlm.Arrear) error {
+	for _, a := range arrears {
+		if err := q.CreateArrear(ctx, db.CreateArrearParams{
+			ReportID:    reportID,
+			Recommender: a.AccountID,
+			Asset:       a.Asset.Code,
+			Issuer:      a.Asset.Issuer,
+			Amount:      a.Amount,
+			CreatedAt:   pgtype.Timestamptz{Time: a.CreatedAt, Valid: true},
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// arrearsHeadroom возвращает, сколько долгов можно добавить к выплате счету в активе,
+// не превысив лимит выплаты актива
+func arrearsHeadroom(res *mlm.DistributeResult, accountID string, asset mlm.Asset) int64 {
+	a, ok := lo.Find(res.Assets, func(a mlm.AssetDistribution) bool { return a.Asset == asset })
+	if !ok || a.PayoutCap <= 0 {
+		return math.MaxInt64
+	}
+
+	dist, _ := lo.Find(res.Distributes, func(dist db.ReportDistribute) bool {
+		return dist.Recommender == accountID && dist.Asset == asset.Code && dist.Issuer == asset.Issuer
+	})
+
+	return max(a.PayoutCap-dist.Amount, 0)
+}
+
+// addDistribute добавляет сумму к выплате рекомендателю или создает новую выплату
+func addDistribute(res *mlm.DistributeResult, accountID string, asset mlm.Asset, amount int64) {
+	for i, dist := range res.Distributes {
+		if dist.Recommender == accountID && dist.Asset == asset.Code && dist.Issuer == asset.Issuer {
+			res.Distributes[i].Amount += amount
+			return
+		}
+	}
+
+	res.Distributes = append(res.Distributes, db.ReportDistribute{
+		Recommender: accountID,
+		Asset:       asset.Code,
+		Issuer:      asset.Issuer,
+		Amount:      amount,
+	})
+}
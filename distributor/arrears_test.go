@@ -0,0 +1,136 @@
+package distributor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/db"
+	"github.com/mtlprog/mlm/stellar"
+	"github.com/samber/lo"
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/keypair"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrearsPersistence(t *testing.T) {
+	recs := recommenders(2)
+	withoutTrustline := recs[1].AccountID
+
+	st := &fakeStellar{
+		balances:    map[string]string{stellar.LABRAsset: "1000"},
+		recs:        func() *mlm.RecommendersFetchResult { return &mlm.RecommendersFetchResult{Recommenders: recs} },
+		noTrustline: map[string]bool{withoutTrustline: true},
+	}
+
+	cfg := dbConfig(keypair.MustRandom().Address())
+
+	var arrear []any
+
+	t.Run("долг сохраняется с отчетом", func(t *testing.T) {
+		d, fdb := newDBDistributor(t, cfg, st)
+		fdb.on("CreateReport", int64(1))
+
+		res, err := d.Distribute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, res.Distributes, 1)
+		require.Equal(t, recs[0].AccountID, res.Distributes[0].Recommender)
+
+		arrears := fdb.called("CreateArrear")
+		require.Len(t, arrears, 1)
+		require.True(t, arrears[0].Tx)
+
+		arrear = arrears[0].Args
+		require.Equal(t, []any{int64(1), withoutTrustline, stellar.LABRAsset, stellar.LABRIssuer, int64(50 * amount.One)}, arrear[:5])
+	})
+
+	t.Run("долг выплачивается после открытия линии доверия", func(t *testing.T) {
+		st.noTrustline = nil
+
+		d, fdb := newDBDistributor(t, cfg, st)
+		fdb.on("CreateReport", int64(3))
+		// Отчет 2 брошен и ничего не выплатил, долги берутся из отчета 1
+		fdb.on("GetReports", []db.Report{{ID: 2}})
+		fdb.on("GetLastPaidReport", db.Report{ID: 1})
+		fdb.on("GetArrears", func(args []any) any {
+			if args[0] != int64(1) {
+				return []db.Arrear{}
+			}
+			return []db.Arrear{{
+				ReportID:    1,
+				Recommender: withoutTrustline,
+				Asset:       stellar.LABRAsset,
+				Issuer:      stellar.LABRIssuer,
+				Amount:      50 * amount.One,
+				CreatedAt:   arrear[5].(pgtype.Timestamptz),
+			}}
+		})
+
+		res, err := d.Distribute(context.Background())
+		require.NoError(t, err)
+
+		require.Equal(t, []any{int64(1)}, fdb.called("GetArrears")[0].Args)
+		require.Len(t, res.ArrearsPaid, 1)
+		require.Empty(t, fdb.called("CreateArrear"))
+
+		paid, _ := lo.Find(res.Distributes, func(d db.ReportDistribute) bool { return d.Recommender == withoutTrustline })
+		require.Equal(t, int64(100*amount.One), paid.Amount)
+	})
+
+	t.Run("просроченный долг списывается", func(t *testing.T) {
+		st.noTrustline = map[string]bool{withoutTrustline: true}
+		cfg.ArrearsExpiry = 24 * time.Hour
+
+		d, fdb := newDBDistributor(t, cfg, st)
+		fdb.on("CreateReport", int64(2))
+		fdb.on("GetLastPaidReport", db.Report{ID: 1})
+		fdb.on("GetArrears", []db.Arrear{{
+			ReportID:    1,
+			Recommender: withoutTrustline,
+			Asset:       stellar.LABRAsset,
+			Issuer:      stellar.LABRIssuer,
+			Amount:      50 * amount.One,
+			CreatedAt:   pgtype.Timestamptz{Time: time.Now().Add(-48 * time.Hour), Valid: true},
+		}})
+
+		res, err := d.Distribute(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, res.ArrearsExpired, 1)
+		require.Len(t, fdb.called("CreateArrear"), 1, "сохраняется только новый долг отчета")
+	})
+
+	t.Run("долг сверх лимита выплаты остается долгом", func(t *testing.T) {
+		st.noTrustline = nil
+		cfg.PayoutCap = 60 * amount.One
+		createdAt := pgtype.Timestamptz{Time: time.Now().Add(-time.Hour), Valid: true}
+
+		d, fdb := newDBDistributor(t, cfg, st)
+		fdb.on("CreateReport", int64(2))
+		fdb.on("GetLastPaidReport", db.Report{ID: 1})
+		fdb.on("GetArrears", []db.Arrear{{
+			ReportID:    1,
+			Recommender: withoutTrustline,
+			Asset:       stellar.LABRAsset,
+			Issuer:      stellar.LABRIssuer,
+			Amount:      50 * amount.One,
+			CreatedAt:   createdAt,
+		}})
+
+		res, err := d.Distribute(context.Background())
+		require.NoError(t, err)
+
+		paid, _ := lo.Find(res.Distributes, func(d db.ReportDistribute) bool { return d.Recommender == withoutTrustline })
+		require.Equal(t, int64(60*amount.One), paid.Amount)
+
+		require.Len(t, res.ArrearsPaid, 1)
+		require.Equal(t, int64(10*amount.One), res.ArrearsPaid[0].Amount)
+
+		arrears := fdb.called("CreateArrear")
+		require.Len(t, arrears, 1)
+		require.Equal(t, []any{int64(2), withoutTrustline, stellar.LABRAsset, stellar.LABRIssuer, int64(40 * amount.One), createdAt}, arrears[0].Args)
+	})
+}
@@ -0,0 +1,200 @@
+package distributor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/config"
+	"github.com/mtlprog/mlm/stellar"
+	"github.com/samber/lo"
+	"github.com/stellar/go/amount"
+)
+
+// getBudget получает баланс программы в активе награды и прочие входные данные политики бюджета
+func (d *Distributor) getBudget(ctx context.Context, ra config.RewardAsset) (mlm.Budget, error) {
+	balstr, err := d.stellar.Balance(ctx, d.cfg.Address, ra.Code, ra.Issuer)
+	if err != nil {
+		return mlm.Budget{}, err
+	}
+
+	bal, err := amount.ParseInt64(balstr)
+	if err != nil {
+		return mlm.Budget{}, err
+	}
+
+	budget := mlm.Budget{
+		Asset:   mlm.Asset{Code: ra.Code, Issuer: ra.Issuer},
+		Policy:  ra.BudgetPolicy,
+		Balance: bal,
+	}
+
+	switch ra.BudgetPolicy {
+	case config.BudgetPolicyFixed:
+		budget.Amount = ra.BudgetAmount
+	case config.BudgetPolicyPercent:
+		budget.Percent = ra.BudgetPercent
+	case config.BudgetPolicyReserve:
+		budget.Reserve = ra.BudgetReserve
+	case config.BudgetPolicyEUR:
+		budget.EUR = ra.BudgetEUR
+
+		eurmtl := d.cfg.Assets.EURMTL
+		if ra.Code == eurmtl.Code && ra.Issuer == eurmtl.Issuer {
+			budget.EURInAsset = ra.BudgetEUR
+			break
+		}
+
+		budget.EURInAsset, err = d.stellar.GetSwapPriceForAmount(ctx,
+			eurmtl.Code, eurmtl.Issuer,
+			ra.Code, ra.Issuer,
+			ra.BudgetEUR)
+		if err != nil {
+			return mlm.Budget{}, fmt.Errorf("convert EUR budget to %s: %w", ra.Code, err)
+		}
+	default:
+		return mlm.Budget{}, fmt.Errorf("unknown budget policy %q", ra.BudgetPolicy)
+	}
+
+	return budget, nil
+}
+
+// BudgetsFromJSON разбирает бюджеты, сохраненные с отчетом. Отчеты до поддержки
+// нескольких активов хранят один бюджет LABR.
+func BudgetsFromJSON(data []byte) ([]mlm.Budget, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var budgets []mlm.Budget
+	if err := json.Unmarshal(data, &budgets); err == nil {
+		return budgets, nil
+	}
+
+	var budget mlm.Budget
+	if err := json.Unmarshal(data, &budget); err != nil {
+		return nil, err
+	}
+
+	if budget.Asset.Code == "" {
+		budget.Asset = mlm.Asset{Code: stellar.LABRAsset, Issuer: stellar.LABRIssuer}
+	}
+
+	return []mlm.Budget{budget}, nil
+}
+
+// BudgetAmount считает сумму распределения по политике бюджета с учетом остатка,
+// перенесенного с прошлого отчета. Вместе с долгами owed, которые выплачиваются сверх
+// суммы распределения, она не превышает баланс, а при политике reserve — баланс
+// за вычетом неснижаемого остатка. Часть суммы, на которую не хватило места из-за долгов,
+// возвращается вторым значением и переносится на следующий отчет. Если баланса не хватает
+// даже на долги, возвращает ErrNoBalance.
+func BudgetAmount(budget mlm.Budget, carryover, owed int64) (int64, int64, error) {
+	if budget.Balance == 0 {
+		return 0, 0, ErrNoBalance
+	}
+
+	limit := budget.Balance
+
+	var base int64
+
+	switch budget.Policy {
+	case config.BudgetPolicyFixed:
+		base = budget.Amount
+	case config.BudgetPolicyPercent:
+		share := new(big.Rat).Quo(ratFromFloat(budget.Percent), big.NewRat(100, 1))
+		base = mulRat(budget.Balance, share)
+	case config.BudgetPolicyReserve:
+		limit = max(budget.Balance-budget.Reserve, 0)
+		base = limit
+	case config.BudgetPolicyEUR:
+		base = budget.EURInAsset
+	default:
+		return 0, 0, fmt.Errorf("unknown budget policy %q", budget.Policy)
+	}
+
+	if limit == 0 || owed > limit {
+		return 0, 0, ErrNoBalance
+	}
+
+	total := min(base+carryover, limit)
+	distributeAmount := min(total, limit-owed)
+
+	return distributeAmount, total - distributeAmount, nil
+}
+
+// AssetBudget — сумма распределения актива и долги рекомендателям по нему с прошлых отчетов.
+// Carryover — часть бюджета, которая не выплачивается в этом отчете и переносится
+// на следующий. Актив без доступного баланса отмечен NoBalance: он не выплачивается,
+// а остаток прошлого отчета и долги переносятся дальше.
+type AssetBudget struct {
+	Budget    mlm.Budget
+	Amount    int64
+	Carryover int64
+	Owed      map[string]*big.Rat
+	NoBalance bool
+}
+
+// getAssetBudgets считает бюджеты всех активов награды с учетом остатков прошлого отчета
+func (d *Distributor) getAssetBudgets(ctx context.Context) ([]AssetBudget, error) {
+	carry, err := d.getCarryover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]AssetBudget, 0, len(d.cfg.RewardAssets))
+
+	for _, ra := range d.cfg.RewardAssets {
+		budget, err := d.getBudget(ctx, ra)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := newAssetBudget(budget, carry[budget.Asset])
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, b)
+	}
+
+	if lo.EveryBy(res, func(b AssetBudget) bool { return b.NoBalance }) {
+		return nil, ErrNoBalance
+	}
+
+	return res, nil
+}
+
+// newAssetBudget добавляет к бюджету актива остаток и долги прошлого отчета
+func newAssetBudget(budget mlm.Budget, prev mlm.AssetDistribution) (AssetBudget, error) {
+	owed := make(map[string]*big.Rat, len(prev.Owed))
+	owedTotal := new(big.Rat)
+	for _, o := range prev.Owed {
+		owed[o.AccountID] = o.Amount
+		owedTotal.Add(owedTotal, o.Amount)
+	}
+
+	// Выплаты по долгам округляются вниз, поэтому дробные части места в бюджете не занимают
+	distributeAmount, deferred, err := BudgetAmount(budget, prev.Carryover, floorRat(owedTotal))
+	if errors.Is(err, ErrNoBalance) {
+		return AssetBudget{
+			Budget:    budget,
+			Carryover: prev.Carryover,
+			Owed:      owed,
+			NoBalance: true,
+		}, nil
+	}
+	if err != nil {
+		return AssetBudget{}, fmt.Errorf("%s: %w", budget.Asset.Code, err)
+	}
+
+	return AssetBudget{
+		Budget:    budget,
+		Amount:    distributeAmount,
+		Carryover: deferred,
+		Owed:      owed,
+	}, nil
+}
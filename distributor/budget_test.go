@@ -0,0 +1,139 @@
+package distributor_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/config"
+	"github.com/mtlprog/mlm/db"
+	"github.com/mtlprog/mlm/distributor"
+	"github.com/mtlprog/mlm/stellar"
+	"github.com/samber/lo"
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/keypair"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudgetAmount(t *testing.T) {
+	tests := []struct {
+		name      string
+		budget    mlm.Budget
+		carryover int64
+		owed      int64
+		want      int64
+		deferred  int64
+		wantErr   error
+	}{
+		{
+			name:   "треть баланса",
+			budget: mlm.Budget{Policy: config.BudgetPolicyPercent, Balance: 300 * amount.One, Percent: 100.0 / 3},
+			want:   100 * amount.One,
+		},
+		{
+			name:      "процент с переносом",
+			budget:    mlm.Budget{Policy: config.BudgetPolicyPercent, Balance: 300 * amount.One, Percent: 10},
+			carryover: 5 * amount.One,
+			want:      35 * amount.One,
+		},
+		{
+			name:   "фиксированная сумма больше баланса",
+			budget: mlm.Budget{Policy: config.BudgetPolicyFixed, Balance: 50 * amount.One, Amount: 100 * amount.One},
+			want:   50 * amount.One,
+		},
+		{
+			name:      "резерв не тратится переносом",
+			budget:    mlm.Budget{Policy: config.BudgetPolicyReserve, Balance: 300 * amount.One, Reserve: 100 * amount.One},
+			carryover: 5 * amount.One,
+			want:      200 * amount.One,
+		},
+		{
+			name:    "баланс ниже резерва",
+			budget:  mlm.Budget{Policy: config.BudgetPolicyReserve, Balance: 50 * amount.One, Reserve: 100 * amount.One},
+			wantErr: distributor.ErrNoBalance,
+		},
+		{
+			name:   "EUR по курсу",
+			budget: mlm.Budget{Policy: config.BudgetPolicyEUR, Balance: 300 * amount.One, EUR: 10 * amount.One, EURInAsset: 40 * amount.One},
+			want:   40 * amount.One,
+		},
+		{
+			name:     "долги не выходят за резерв",
+			budget:   mlm.Budget{Policy: config.BudgetPolicyReserve, Balance: 300 * amount.One, Reserve: 100 * amount.One},
+			owed:     30 * amount.One,
+			want:     170 * amount.One,
+			deferred: 30 * amount.One,
+		},
+		{
+			name:      "долги с переносом не выходят за баланс",
+			budget:    mlm.Budget{Policy: config.BudgetPolicyFixed, Balance: 50 * amount.One, Amount: 40 * amount.One},
+			carryover: 5 * amount.One,
+			owed:      20 * amount.One,
+			want:      30 * amount.One,
+			deferred:  15 * amount.One,
+		},
+		{
+			name:   "долги в пределах баланса",
+			budget: mlm.Budget{Policy: config.BudgetPolicyFixed, Balance: 100 * amount.One, Amount: 40 * amount.One},
+			owed:   20 * amount.One,
+			want:   40 * amount.One,
+		},
+		{
+			name:    "долги больше баланса",
+			budget:  mlm.Budget{Policy: config.BudgetPolicyReserve, Balance: 120 * amount.One, Reserve: 100 * amount.One},
+			owed:    30 * amount.One,
+			wantErr: distributor.ErrNoBalance,
+		},
+		{
+			name:    "пустой баланс",
+			budget:  mlm.Budget{Policy: config.BudgetPolicyFixed, Amount: amount.One},
+			wantErr: distributor.ErrNoBalance,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, deferred, err := distributor.BudgetAmount(tt.budget, tt.carryover, tt.owed)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+			require.Equal(t, tt.deferred, deferred)
+		})
+	}
+}
+
+func TestOwedWithinReserve(t *testing.T) {
+	recs := recommenders(2)
+	st := &fakeStellar{
+		balances: map[string]string{stellar.LABRAsset: "300"},
+		recs:     func() *mlm.RecommendersFetchResult { return &mlm.RecommendersFetchResult{Recommenders: recs} },
+	}
+
+	cfg := dbConfig(keypair.MustRandom().Address())
+	cfg.RewardAssets[0].BudgetPolicy = config.BudgetPolicyReserve
+	cfg.RewardAssets[0].BudgetReserve = 100 * amount.One
+
+	d, fdb := newDBDistributor(t, cfg, st)
+	fdb.on("GetLastPaidReport", db.Report{ID: 1})
+	fdb.on("GetCarryover", []db.Carryover{{
+		ReportID:    1,
+		Recommender: pgtype.Text{String: recs[0].AccountID, Valid: true},
+		Asset:       stellar.LABRAsset,
+		Issuer:      stellar.LABRIssuer,
+		Amount:      pgtype.Numeric{Int: big.NewInt(30 * amount.One), Exp: 0, Valid: true},
+	}})
+
+	res, err := d.Distribute(context.Background(), mlm.WithoutReport())
+	require.NoError(t, err)
+
+	require.Equal(t, int64(200*amount.One), lo.SumBy(res.Distributes, func(d db.ReportDistribute) int64 { return d.Amount }),
+		"долг и распределение вместе не тратят резерв")
+	require.Equal(t, int64(170*amount.One), res.Assets[0].Amount)
+	require.Equal(t, int64(30*amount.One), res.Assets[0].Carryover, "вытесненная долгом часть переносится")
+}
@@ -0,0 +1,84 @@
+package distributor
+
+import (
+	"math/big"
+
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/config"
+	"github.com/mtlprog/mlm/db"
+)
+
+// payoutCap возвращает максимальную выплату одному рекомендателю, 0 — без ограничения.
+// Если заданы и абсолютный лимит, и доля от суммы распределения, действует меньший.
+func (d *Distributor) payoutCap(amount int64) int64 {
+	limit := d.cfg.PayoutCap
+
+	if d.cfg.PayoutCapShare > 0 {
+		share := new(big.Rat).Quo(ratFromFloat(d.cfg.PayoutCapShare), big.NewRat(100, 1))
+		shareLimit := mulRat(amount, share)
+		if limit == 0 || shareLimit < limit {
+			limit = shareLimit
+		}
+	}
+
+	return limit
+}
+
+// applyPayoutCap урезает выплаты актива выше лимита. Излишек либо распределяется между
+// неограниченными рекомендателями пропорционально их выплатам, либо переносится
+// на следующий отчёт. Остаток, который некому распределить, тоже переносится.
+func (d *Distributor) applyPayoutCap(res *mlm.AssetDistribution, distributes []db.ReportDistribute) {
+	limit := d.payoutCap(res.Amount)
+	if limit <= 0 {
+		return
+	}
+
+	res.PayoutCap = limit
+
+	capped := make(map[int]struct{})
+
+	for {
+		excess := int64(0)
+
+		for i := range distributes {
+			if distributes[i].Amount <= limit {
+				continue
+			}
+
+			over := distributes[i].Amount - limit
+			distributes[i].Amount = limit
+			distributes[i].Capped += over
+			capped[i] = struct{}{}
+			excess += over
+		}
+
+		if excess == 0 {
+			return
+		}
+
+		uncappedTotal := int64(0)
+		for i, dist := range distributes {
+			if _, ok := capped[i]; !ok {
+				uncappedTotal += dist.Amount
+			}
+		}
+
+		if d.cfg.PayoutCapExcess == config.PayoutCapExcessCarryover || uncappedTotal == 0 {
+			res.Carryover += excess
+			return
+		}
+
+		redistributed := int64(0)
+		for i := range distributes {
+			if _, ok := capped[i]; ok {
+				continue
+			}
+
+			add := mulDiv(excess, distributes[i].Amount, uncappedTotal)
+			distributes[i].Amount += add
+			redistributed += add
+		}
+
+		res.Carryover += excess - redistributed
+	}
+}
@@ -0,0 +1,155 @@
+package distributor
+
+import (
+	"context"
+	"math/big"
+	"slices"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/db"
+	"github.com/samber/lo"
+)
+
+// carryoverScale — число знаков после запятой (в строупах), с которым хранятся остатки
+const carryoverScale = 18
+
+// getCarryover возвращает по активам нераспределенный остаток последнего выплаченного
+// отчета и суммы, которые остались должны рекомендателям
+func (d *Distributor) getCarryover(ctx context.Context) (map[mlm.Asset]mlm.AssetDistribution, error) {
+	res := make(map[mlm.Asset]mlm.AssetDistribution)
+
+	reportID, err := d.lastPaidReport(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if reportID == 0 {
+		return res, nil
+	}
+
+	rows, err := d.q.GetCarryover(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range CarryoverFromRows(rows) {
+		res[a.Asset] = a
+	}
+
+	return res, nil
+}
+
+// CarryoverFromRows разбирает записи журнала остатков на общий остаток и долги
+// рекомендателям по каждому активу. Заполнены только Asset, Carryover и Owed.
+func CarryoverFromRows(rows []db.Carryover) []mlm.AssetDistribution {
+	res := make([]mlm.AssetDistribution, 0)
+
+	for _, row := range rows {
+		asset := mlm.Asset{Code: row.Asset, Issuer: row.Issuer}
+
+		i := slices.IndexFunc(res, func(a mlm.AssetDistribution) bool { return a.Asset == asset })
+		if i < 0 {
+			res = append(res, mlm.AssetDistribution{Asset: asset, Owed: make([]mlm.Owed, 0)})
+			i = len(res) - 1
+		}
+
+		amount := ratFromNumeric(row.Amount)
+
+		if !row.Recommender.Valid {
+			res[i].Carryover += floorRat(amount)
+			continue
+		}
+
+		res[i].Owed = append(res[i].Owed, mlm.Owed{
+			AccountID: row.Recommender.String,
+			Amount:    amount,
+		})
+	}
+
+	return res
+}
+
+// AssetsFromReport собирает распределения активов сохраненного отчета из бюджетов
+// и журнала остатков
+func AssetsFromReport(budgets []mlm.Budget, carryover []db.Carryover) []mlm.AssetDistribution {
+	carry := CarryoverFromRows(carryover)
+
+	res := lo.Map(budgets, func(b mlm.Budget, _ int) mlm.AssetDistribution {
+		a, _ := lo.Find(carry, func(a mlm.AssetDistribution) bool { return a.Asset == b.Asset })
+		a.Asset = b.Asset
+		a.Budget = b
+		return a
+	})
+
+	for _, a := range carry {
+		if !lo.ContainsBy(res, func(r mlm.AssetDistribution) bool { return r.Asset == a.Asset }) {
+			res = append(res, a)
+		}
+	}
+
+	return res
+}
+
+func (d *Distributor) createCarryover(ctx context.Context, q *db.Queries, reportID int64, assets []mlm.AssetDistribution) error {
+	for _, a := range assets {
+		if a.Carryover > 0 {
+			if err := q.CreateCarryover(ctx, db.CreateCarryoverParams{
+				ReportID: reportID,
+				Asset:    a.Asset.Code,
+				Issuer:   a.Asset.Issuer,
+				Amount:   numericFromRat(new(big.Rat).SetInt64(a.Carryover)),
+			}); err != nil {
+				return err
+			}
+		}
+
+		for _, o := range a.Owed {
+			if err := q.CreateCarryover(ctx, db.CreateCarryoverParams{
+				ReportID:    reportID,
+				Recommender: pgtype.Text{String: o.AccountID, Valid: true},
+				Asset:       a.Asset.Code,
+				Issuer:      a.Asset.Issuer,
+				Amount:      numericFromRat(o.Amount),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// numericFromRat округляет дробь вниз до carryoverScale знаков
+func numericFromRat(r *big.Rat) pgtype.Numeric {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(carryoverScale), nil)
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(scale))
+
+	return pgtype.Numeric{
+		Int:   new(big.Int).Div(scaled.Num(), scaled.Denom()),
+		Exp:   -carryoverScale,
+		Valid: true,
+	}
+}
+
+func ratFromNumeric(n pgtype.Numeric) *big.Rat {
+	if !n.Valid || n.Int == nil {
+		return new(big.Rat)
+	}
+
+	r := new(big.Rat).SetInt(n.Int)
+	exp := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(n.Exp))), nil)
+
+	if n.Exp < 0 {
+		return r.Quo(r, new(big.Rat).SetInt(exp))
+	}
+
+	return r.Mul(r, new(big.Rat).SetInt(exp))
+}
+
+func abs(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,76 @@
+package distributor_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/db"
+	"github.com/mtlprog/mlm/distributor"
+	"github.com/mtlprog/mlm/stellar"
+	"github.com/samber/lo"
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/keypair"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCarryoverFromRows(t *testing.T) {
+	assets := distributor.CarryoverFromRows([]db.Carryover{
+		{ReportID: 1, Asset: stellar.LABRAsset, Issuer: stellar.LABRIssuer, Amount: pgtype.Numeric{Int: big.NewInt(15), Exp: 0, Valid: true}},
+		{ReportID: 1, Asset: stellar.LABRAsset, Issuer: stellar.LABRIssuer, Recommender: pgtype.Text{String: "rec1", Valid: true}, Amount: pgtype.Numeric{Int: big.NewInt(25), Exp: -2, Valid: true}},
+		{ReportID: 1, Asset: stellar.EURMTLAsset, Issuer: stellar.EURMTLIssuer, Amount: pgtype.Numeric{Int: big.NewInt(7), Exp: 0, Valid: true}},
+	})
+
+	require.Len(t, assets, 2)
+
+	require.Equal(t, mlm.Asset{Code: stellar.LABRAsset, Issuer: stellar.LABRIssuer}, assets[0].Asset)
+	require.Equal(t, int64(15), assets[0].Carryover)
+	require.Len(t, assets[0].Owed, 1)
+	require.Equal(t, "rec1", assets[0].Owed[0].AccountID)
+	require.Equal(t, big.NewRat(1, 4), assets[0].Owed[0].Amount)
+
+	require.Equal(t, mlm.Asset{Code: stellar.EURMTLAsset, Issuer: stellar.EURMTLIssuer}, assets[1].Asset)
+	require.Equal(t, int64(7), assets[1].Carryover)
+	require.Empty(t, assets[1].Owed)
+}
+
+func TestCarryoverFromLastPaidReport(t *testing.T) {
+	recs := recommenders(1)
+	st := &fakeStellar{
+		balances: map[string]string{stellar.LABRAsset: "1000"},
+		recs:     func() *mlm.RecommendersFetchResult { return &mlm.RecommendersFetchResult{Recommenders: recs} },
+	}
+
+	d, fdb := newDBDistributor(t, dbConfig(keypair.MustRandom().Address()), st)
+	fdb.on("CreateReport", int64(3))
+	// Отчет 2 брошен: ни одна его транзакция не выполнена
+	fdb.on("GetReports", []db.Report{{ID: 2}})
+	fdb.on("GetLastPaidReport", db.Report{ID: 1})
+	fdb.on("GetCarryover", func(args []any) any {
+		return []db.Carryover{{
+			ReportID: args[0].(int64),
+			Asset:    stellar.LABRAsset,
+			Issuer:   stellar.LABRIssuer,
+			Amount:   pgtype.Numeric{Int: big.NewInt(args[0].(int64) * 10 * amount.One), Exp: 0, Valid: true},
+		}}
+	})
+
+	res, err := d.Distribute(context.Background())
+	require.NoError(t, err)
+
+	require.Equal(t, []any{int64(1)}, fdb.called("GetCarryover")[0].Args)
+
+	paid, _ := lo.Find(res.Distributes, func(d db.ReportDistribute) bool { return d.Recommender == recs[0].AccountID })
+	require.Equal(t, int64(110*amount.One), paid.Amount, "перенос берется из выплаченного отчета 1")
+}
+
+func TestDistributeRefusesWhilePending(t *testing.T) {
+	d, fdb := newDBDistributor(t, dbConfig(keypair.MustRandom().Address()), &fakeStellar{})
+	fdb.on("GetPendingReport", db.Report{ID: 2})
+
+	_, err := d.Distribute(context.Background())
+	require.ErrorIs(t, err, distributor.ErrPendingReport)
+	require.Empty(t, fdb.called("CreateReport"))
+}
@@ -0,0 +1,119 @@
+package distributor
+
+import (
+	"context"
+	"slices"
+
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/config"
+	"github.com/mtlprog/mlm/db"
+	"github.com/samber/lo"
+)
+
+// resolveConflicts выбирает по политике конфликтов рекомендателя, которому засчитывается
+// дважды рекомендованный аккаунт. Конфликты без выбранного рекомендателя остаются
+// неразрешенными и либо пропускаются, либо делятся поровну. Если beforeReportID не 0,
+// политика earliest учитывает только отчеты до него.
+func (d *Distributor) resolveConflicts(ctx context.Context, beforeReportID int64, recs *mlm.RecommendersFetchResult) error {
+	recs.ConflictWinners = make(map[string]string)
+
+	if len(recs.Conflict) == 0 {
+		return nil
+	}
+
+	switch d.cfg.ConflictPolicy {
+	case config.ConflictPolicyEarliest:
+		rows, err := d.q.GetFirstRecommendations(ctx, db.GetFirstRecommendationsParams{
+			BeforeReportID: beforeReportID,
+			Recommended:    lo.Keys(recs.Conflict),
+		})
+		if err != nil {
+			return err
+		}
+
+		first := make(map[string]map[string]int64) // recommended-recommender-unix
+		for _, row := range rows {
+			if _, ok := first[row.Recommended]; !ok {
+				first[row.Recommended] = make(map[string]int64)
+			}
+			first[row.Recommended][row.Recommender] = row.FirstAt.Time.Unix()
+		}
+
+		for recommended, recommenders := range recs.Conflict {
+			if winner, ok := earliestRecommender(first[recommended], recommenders); ok {
+				recs.ConflictWinners[recommended] = winner
+			}
+		}
+	case config.ConflictPolicyManual:
+		rows, err := d.q.GetConflictResolutions(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			recommenders, ok := recs.Conflict[row.Recommended]
+			if ok && slices.Contains(recommenders, row.Recommender) {
+				recs.ConflictWinners[row.Recommended] = row.Recommender
+			}
+		}
+	}
+
+	return nil
+}
+
+// earliestRecommender возвращает рекомендателя, рекомендация которого раньше всех
+// попала в отчеты. Если истории нет ни у одного, конфликт не разрешается.
+func earliestRecommender(first map[string]int64, recommenders []string) (string, bool) {
+	var (
+		winner string
+		at     int64
+	)
+
+	for _, recommender := range recommenders {
+		t, ok := first[recommender]
+		if !ok {
+			continue
+		}
+
+		if winner == "" || t < at {
+			winner, at = recommender, t
+		}
+	}
+
+	return winner, winner != ""
+}
+
+// conflictShare возвращает, учитывается ли рекомендация, и на сколько рекомендателей
+// делится награда за нее
+func (d *Distributor) conflictShare(recs *mlm.RecommendersFetchResult, recommender, recommended string) (bool, int) {
+	recommenders, ok := recs.Conflict[recommended]
+	if !ok {
+		return true, 1
+	}
+
+	if winner, ok := recs.ConflictWinners[recommended]; ok {
+		return winner == recommender, 1
+	}
+
+	if d.cfg.ConflictPolicy == config.ConflictPolicySplit {
+		return true, len(recommenders)
+	}
+
+	return false, 0
+}
+
+// conflictResolution возвращает решение по конфликтующей рекомендации для отчета
+func (d *Distributor) conflictResolution(recs *mlm.RecommendersFetchResult, recommender, recommended string) string {
+	if winner, ok := recs.ConflictWinners[recommended]; ok {
+		if winner == recommender {
+			return mlm.ConflictResolutionWon
+		}
+		return mlm.ConflictResolutionLost
+	}
+
+	if d.cfg.ConflictPolicy == config.ConflictPolicySplit {
+		return mlm.ConflictResolutionSplit
+	}
+
+	return mlm.ConflictResolutionSkip
+}
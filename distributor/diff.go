@@ -0,0 +1,220 @@
+package distributor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/db"
+	"github.com/mtlprog/mlm/stellar"
+	"github.com/samber/lo"
+)
+
+// Diff сравнивает сохраненный отчет to с отчетом from
+func (d *Distributor) Diff(ctx context.Context, from, to int64) (*mlm.ReportDiff, error) {
+	prevRecommends, prevConflicts, err := d.getReportGraph(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+
+	recommends, conflicts, err := d.getReportGraph(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+
+	prevBalances, err := d.getReportBalances(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+
+	balances, err := d.getReportBalances(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := DiffReports(prevRecommends, prevConflicts, prevBalances, recommends, conflicts, balances)
+	diff.From, diff.To = from, to
+
+	return &diff, nil
+}
+
+// diffWithLatest сравнивает новый отчет с последним выплаченным: брошенный отчет ничего
+// не выплатил, и изменения считаются от того, что было оплачено. Если выплаченных отчетов
+// еще нет, возвращает nil. snapshot — снимок, из которого построен новый отчет.
+func (d *Distributor) diffWithLatest(ctx context.Context, res *mlm.DistributeResult, snapshot *mlm.Snapshot) (*mlm.ReportDiff, error) {
+	reportID, err := d.lastPaidReport(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if reportID == 0 {
+		return nil, nil
+	}
+
+	prevRecommends, prevConflicts, err := d.getReportGraph(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	prevBalances, err := d.getReportBalances(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	var balances map[string]int64
+	if snapshot != nil {
+		balances = stellar.MTLAPBalances(snapshot)
+	}
+
+	diff := DiffReports(prevRecommends, prevConflicts, prevBalances, res.Recommends, res.Conflicts, balances)
+	diff.From = reportID
+
+	return &diff, nil
+}
+
+func (d *Distributor) getReportGraph(ctx context.Context, reportID int64) ([]db.ReportRecommend, []db.ReportConflict, error) {
+	if _, err := d.q.GetReport(ctx, reportID); err != nil {
+		return nil, nil, err
+	}
+
+	recommends, err := d.q.GetReportRecommends(ctx, reportID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conflicts, err := d.q.GetReportConflicts(ctx, reportID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return recommends, conflicts, nil
+}
+
+// getReportBalances возвращает MTLAP счетов из снимка отчета. Для отчета без снимка
+// возвращает nil.
+func (d *Distributor) getReportBalances(ctx context.Context, reportID int64) (map[string]int64, error) {
+	row, err := d.q.GetReportSnapshot(ctx, reportID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := SnapshotFromRow(row)
+	if err != nil {
+		return nil, fmt.Errorf("decode snapshot of report %d: %w", reportID, err)
+	}
+
+	return stellar.MTLAPBalances(snapshot), nil
+}
+
+// DiffReports находит новых и пропавших рекомендателей, рекомендуемых, которых засчитывают
+// другим рекомендателям, падения MTLAP, а также появившиеся и исчезнувшие конфликты.
+// Падения MTLAP считаются по балансам из снимков, а не по засчитанному с учетом удержания
+// MTLAP. Если у отчета нет снимка (балансы nil), берется MTLAP, сохраненный в отчете.
+// Все списки отсортированы по счетам.
+func DiffReports(
+	prevRecommends []db.ReportRecommend,
+	prevConflicts []db.ReportConflict,
+	prevBalances map[string]int64,
+	recommends []db.ReportRecommend,
+	conflicts []db.ReportConflict,
+	balances map[string]int64,
+) mlm.ReportDiff {
+	diff := mlm.ReportDiff{
+		NewRecommenders:      make([]string, 0),
+		VanishedRecommenders: make([]string, 0),
+		Moved:                make([]mlm.MovedRecommendation, 0),
+		MTLAPDrops:           make([]mlm.MTLAPDrop, 0),
+	}
+
+	prevRecommenders := recommendersOf(prevRecommends)
+	nextRecommenders := recommendersOf(recommends)
+
+	diff.NewRecommenders, diff.VanishedRecommenders = lo.Difference(nextRecommenders, prevRecommenders)
+
+	prevByRecommended := recommendedIndex(prevRecommends, prevBalances)
+	nextByRecommended := recommendedIndex(recommends, balances)
+
+	for _, recommended := range sortedKeys(nextByRecommended) {
+		next := nextByRecommended[recommended]
+
+		prev, ok := prevByRecommended[recommended]
+		if !ok {
+			continue
+		}
+
+		if !slices.Equal(prev.recommenders, next.recommenders) {
+			diff.Moved = append(diff.Moved, mlm.MovedRecommendation{
+				Recommended: recommended,
+				From:        prev.recommenders,
+				To:          next.recommenders,
+			})
+		}
+
+		if next.mtlap < prev.mtlap {
+			diff.MTLAPDrops = append(diff.MTLAPDrops, mlm.MTLAPDrop{
+				Recommended: recommended,
+				From:        prev.mtlap,
+				To:          next.mtlap,
+			})
+		}
+	}
+
+	prevConflicted := conflictedOf(prevConflicts)
+	nextConflicted := conflictedOf(conflicts)
+
+	diff.ConflictsAppeared, diff.ConflictsResolved = lo.Difference(nextConflicted, prevConflicted)
+
+	return diff
+}
+
+// recommendedState — рекомендатели и MTLAP рекомендуемого в одном отчете
+type recommendedState struct {
+	recommenders []string
+	mtlap        int64
+}
+
+func recommendedIndex(recommends []db.ReportRecommend, balances map[string]int64) map[string]recommendedState {
+	res := make(map[string]recommendedState)
+
+	for _, r := range recommends {
+		state := res[r.Recommended]
+		state.recommenders = append(state.recommenders, r.Recommender)
+		state.mtlap = r.RecommendedMtlap
+		if balances != nil {
+			state.mtlap = balances[r.Recommended]
+		}
+		res[r.Recommended] = state
+	}
+
+	for recommended, state := range res {
+		slices.Sort(state.recommenders)
+		state.recommenders = slices.Compact(state.recommenders)
+		res[recommended] = state
+	}
+
+	return res
+}
+
+func recommendersOf(recommends []db.ReportRecommend) []string {
+	res := lo.Uniq(lo.Map(recommends, func(r db.ReportRecommend, _ int) string { return r.Recommender }))
+	slices.Sort(res)
+	return res
+}
+
+func conflictedOf(conflicts []db.ReportConflict) []string {
+	res := lo.Uniq(lo.Map(conflicts, func(c db.ReportConflict, _ int) string { return c.Recommended }))
+	slices.Sort(res)
+	return res
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := lo.Keys(m)
+	slices.Sort(keys)
+	return keys
+}
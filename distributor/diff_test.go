@@ -0,0 +1,87 @@
+package distributor_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/db"
+	"github.com/mtlprog/mlm/distributor"
+	"github.com/mtlprog/mlm/stellar"
+	"github.com/stellar/go/keypair"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffReports(t *testing.T) {
+	prevRecommends := []db.ReportRecommend{
+		{Recommender: "rec1", Recommended: "user1", RecommendedMtlap: 10},
+		{Recommender: "rec1", Recommended: "user2", RecommendedMtlap: 5},
+		{Recommender: "rec2", Recommended: "user3", RecommendedMtlap: 7},
+	}
+	prevConflicts := []db.ReportConflict{
+		{Recommender: "rec1", Recommended: "user4", Resolution: mlm.ConflictResolutionSkip},
+		{Recommender: "rec2", Recommended: "user4", Resolution: mlm.ConflictResolutionSkip},
+	}
+
+	recommends := []db.ReportRecommend{
+		{Recommender: "rec1", Recommended: "user1", RecommendedMtlap: 8},
+		{Recommender: "rec3", Recommended: "user2", RecommendedMtlap: 6},
+		{Recommender: "rec3", Recommended: "user4", RecommendedMtlap: 1},
+	}
+	conflicts := []db.ReportConflict{
+		{Recommender: "rec1", Recommended: "user5", Resolution: mlm.ConflictResolutionSkip},
+		{Recommender: "rec3", Recommended: "user5", Resolution: mlm.ConflictResolutionSkip},
+	}
+
+	t.Run("без снимков", func(t *testing.T) {
+		diff := distributor.DiffReports(prevRecommends, prevConflicts, nil, recommends, conflicts, nil)
+
+		require.Equal(t, mlm.ReportDiff{
+			NewRecommenders:      []string{"rec3"},
+			VanishedRecommenders: []string{"rec2"},
+			Moved: []mlm.MovedRecommendation{
+				{Recommended: "user2", From: []string{"rec1"}, To: []string{"rec3"}},
+			},
+			MTLAPDrops: []mlm.MTLAPDrop{
+				{Recommended: "user1", From: 10, To: 8},
+			},
+			ConflictsAppeared: []string{"user5"},
+			ConflictsResolved: []string{"user4"},
+		}, diff)
+	})
+
+	t.Run("падения по балансам снимков", func(t *testing.T) {
+		// user1 ждет удержания: засчитано 8 при балансе 12, это не падение.
+		// user2 продал MTLAP, но засчитанное значение не изменилось.
+		prevBalances := map[string]int64{"user1": 10, "user2": 9, "user3": 7}
+		balances := map[string]int64{"user1": 12, "user2": 6, "user4": 1}
+
+		diff := distributor.DiffReports(prevRecommends, prevConflicts, prevBalances, recommends, conflicts, balances)
+
+		require.Equal(t, []mlm.MTLAPDrop{
+			{Recommended: "user2", From: 9, To: 6},
+		}, diff.MTLAPDrops)
+	})
+}
+
+func TestDiffWithLastPaidReport(t *testing.T) {
+	recs := recommenders(1)
+	st := &fakeStellar{
+		balances: map[string]string{stellar.LABRAsset: "1000"},
+		recs:     func() *mlm.RecommendersFetchResult { return &mlm.RecommendersFetchResult{Recommenders: recs} },
+	}
+
+	d, fdb := newDBDistributor(t, dbConfig(keypair.MustRandom().Address()), st)
+	// Отчет 2 брошен: ни одна его транзакция не выполнена
+	fdb.on("GetReports", []db.Report{{ID: 2}})
+	fdb.on("GetLastPaidReport", db.Report{ID: 1})
+	fdb.on("GetReport", func(args []any) any { return db.Report{ID: args[0].(int64)} })
+
+	res, err := d.Distribute(context.Background(), mlm.WithoutReport(), mlm.WithDiff())
+	require.NoError(t, err)
+
+	require.NotNil(t, res.Diff)
+	require.Equal(t, int64(1), res.Diff.From)
+	require.Equal(t, []any{int64(1)}, fdb.called("GetReportRecommends")[0].Args)
+	require.Equal(t, []string{recs[0].AccountID}, res.Diff.NewRecommenders)
+}
@@ -2,10 +2,12 @@ package distributor
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"math"
-	"strconv"
+	"math/big"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/mtlprog/mlm"
@@ -14,17 +16,30 @@ import (
 	"github.com/mtlprog/mlm/stellar"
 	"github.com/jackc/pgx/v5"
 	"github.com/samber/lo"
+	"github.com/stellar/go/amount"
 	"github.com/stellar/go/txnbuild"
 )
 
 var ErrNoBalance = errors.New("no balance")
 var ErrNoDistributes = errors.New("no distributes: nothing to distribute")
+var ErrBudgetExceeded = errors.New("sum of payouts exceeds distribute amount")
+var ErrInvalidParts = errors.New("reward policy returned non-finite parts")
+var ErrPendingReport = errors.New("previous report is not submitted yet")
+
+// maxOperationsPerTransaction — ограничение Stellar на число операций в одной транзакции
+const maxOperationsPerTransaction = 100
+
+// TxBeginner начинает транзакцию базы данных, в которой сохраняется отчет
+type TxBeginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
 
 type Distributor struct {
 	cfg     *config.Config
 	stellar mlm.StellarAgregator
 	q       *db.Queries
-	pg      *pgx.Conn
+	pg      TxBeginner
+	policy  mlm.RewardPolicy
 }
 
 func (d *Distributor) Distribute(ctx context.Context, opts ...mlm.DistributeOption) (*mlm.DistributeResult, error) {
@@ -39,12 +54,24 @@ func (d *Distributor) Distribute(ctx context.Context, opts ...mlm.DistributeOpti
 	}
 	defer func() { _ = d.q.UnlockReport(ctx) }()
 
-	lastDistribute, err := d.getLastDistribute(ctx)
+	// Пока прошлый отчет может быть выплачен, новый отчет выплатил бы его перенос
+	// и долги еще раз
+	if !opt.WithoutReport {
+		pending, err := d.q.GetPendingReport(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		if pending.ID != 0 {
+			return nil, fmt.Errorf("report %d: %w", pending.ID, ErrPendingReport)
+		}
+	}
+
+	highWater, err := d.getHighWaterMarks(ctx, 0)
 	if err != nil {
 		return nil, err
 	}
 
-	distributeAmount, err := d.getDistributeAmount(ctx)
+	budgets, err := d.getAssetBudgets(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -54,11 +81,29 @@ func (d *Distributor) Distribute(ctx context.Context, opts ...mlm.DistributeOpti
 		return nil, err
 	}
 
-	res, err := d.CalculateParts(lastDistribute, distributeAmount, recs)
+	graphIssues := stellar.ValidateGraph(recs, d.cfg.GraphPolicy)
+
+	if err := d.loadExclusions(ctx, recs); err != nil {
+		return nil, err
+	}
+
+	if err := d.resolveConflicts(ctx, 0, recs); err != nil {
+		return nil, err
+	}
+
+	pendingVesting, err := d.vest(ctx, 0, time.Now(), recs, highWater)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := d.CalculateParts(highWater, budgets, recs)
 	if err != nil {
 		return nil, err
 	}
 
+	res.PendingVesting = pendingVesting
+	res.GraphIssues = graphIssues
+
 	res.SourceAddress = d.cfg.Address
 
 	res.MissingTrustlines, err = d.checkTrustlines(ctx, res.Distributes)
@@ -66,16 +111,32 @@ func (d *Distributor) Distribute(ctx context.Context, opts ...mlm.DistributeOpti
 		return nil, err
 	}
 
+	arrears, err := d.getArrears(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.applyArrears(ctx, res, arrears); err != nil {
+		return nil, err
+	}
+
+	if opt.WithDiff {
+		res.Diff, err = d.diffWithLatest(ctx, res, recs.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if opt.WithoutReport {
 		return res, nil
 	}
 
-	res.XDR, err = d.getXDR(ctx, res.Distributes)
+	res.XDRs, err = d.getXDRs(ctx, res.Distributes)
 	if err != nil {
 		return nil, err
 	}
 
-	res.ReportID, err = d.createReport(ctx, res)
+	res.ReportID, err = d.createReport(ctx, res, recs.Snapshot)
 	if err != nil {
 		return nil, err
 	}
@@ -83,53 +144,48 @@ func (d *Distributor) Distribute(ctx context.Context, opts ...mlm.DistributeOpti
 	return res, nil
 }
 
-func (d *Distributor) getLastDistribute(ctx context.Context) (map[string]map[string]int64, error) {
-	rr, err := d.q.GetReports(ctx, 1)
+// getHighWaterMarks возвращает максимальный MTLAP каждого рекомендуемого за все выплаченные
+// отчеты: брошенный отчет ничего не оплатил, и его рекорды не учитываются.
+// Награду приносит только MTLAP выше этого максимума, у какого бы рекомендателя
+// ни был рекомендуемый, поэтому падение и возврат MTLAP или смена рекомендателя
+// не оплачиваются повторно. Если beforeReportID не 0, учитываются только отчеты до него.
+func (d *Distributor) getHighWaterMarks(ctx context.Context, beforeReportID int64) (map[string]int64, error) {
+	rows, err := d.q.GetMTLAPHighWaterMarks(ctx, beforeReportID)
 	if err != nil {
 		return nil, err
 	}
 
-	lastDistribute := map[string]map[string]int64{} // recommender-recommended-mtlap
-
-	if len(rr) > 0 {
-		ras, err := d.q.GetReportRecommends(ctx, rr[0].ID)
-		if err != nil {
-			return nil, err
-		}
-
-		for _, ra := range ras {
-			if _, ok := lastDistribute[ra.Recommender]; !ok {
-				lastDistribute[ra.Recommender] = make(map[string]int64)
-			}
+	highWater := make(map[string]int64, len(rows)) // recommended-mtlap
 
-			lastDistribute[ra.Recommender][ra.Recommended] = ra.RecommendedMtlap
-		}
+	for _, row := range rows {
+		highWater[row.Recommended] = row.Mtlap
 	}
 
-	return lastDistribute, nil
+	return highWater, nil
 }
 
-func (d *Distributor) getDistributeAmount(ctx context.Context) (float64, error) {
-	balstr, err := d.stellar.Balance(ctx, d.cfg.Address, stellar.LABRAsset, stellar.LABRIssuer)
-	if err != nil {
-		return 0, err
+// lastPaidReport возвращает последний отчет, хотя бы одна транзакция которого выполнена,
+// или 0, если такого нет. Перенос и долги берутся из него: брошенный отчет, который
+// так и не был отправлен, ничего не выплатил. Если beforeReportID не 0, учитываются
+// только отчеты до него.
+func (d *Distributor) lastPaidReport(ctx context.Context, beforeReportID int64) (int64, error) {
+	rep, err := d.q.GetLastPaidReport(ctx, beforeReportID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
 	}
-
-	bal, err := strconv.ParseFloat(balstr, 64)
 	if err != nil {
 		return 0, err
 	}
 
-	if bal == 0 {
-		return 0, ErrNoBalance
-	}
-
-	return bal / 3 * 10000000 / 10000000, nil
+	return rep.ID, nil
 }
 
+// CalculateParts делит бюджет каждого актива между рекомендателями в одинаковых долях
+// и добавляет к выплатам долги прошлых отчетов. Дробная часть выплаты меньше строупа
+// остается в долгах.
 func (d *Distributor) CalculateParts(
-	lastDistribute map[string]map[string]int64,
-	distributeAmount float64,
+	highWater map[string]int64,
+	budgets []AssetBudget,
 	recs *mlm.RecommendersFetchResult,
 ) (*mlm.DistributeResult, error) {
 	res := &mlm.DistributeResult{
@@ -137,32 +193,60 @@ func (d *Distributor) CalculateParts(
 		Recommends:      make([]db.ReportRecommend, 0),
 		Distributes:     make([]db.ReportDistribute, 0),
 		RecommendDeltas: make([]mlm.RecommendDelta, 0),
+		Assets:          make([]mlm.AssetDistribution, 0, len(budgets)),
 		CreatedAt:       time.Now(),
-		Amount:          distributeAmount,
+		RewardPolicy:    d.policy.Name(),
+		Exclusions:      reportExclusions(recs),
 	}
 
-	// Сначала посчитаем общее количество новых/измененных MTLAP
-	totalNewMTLAP := int64(0)
+	// Сначала посчитаем доли каждого рекомендателя по формуле награды
+	parts := make([]*big.Rat, len(recs.Recommenders))
+	totalParts := new(big.Rat)
+
+	for i, recommender := range recs.Recommenders {
+		if isExcluded(recs, recommender.AccountID) {
+			parts[i] = new(big.Rat)
+			continue
+		}
+
+		changes := make([]mlm.RewardChange, 0, len(recommender.Recommended))
+		splitParts := new(big.Rat)
 
-	for _, recommender := range recs.Recommenders {
 		for _, recommended := range recommender.Recommended {
-			if _, ok := recs.Conflict[recommended.AccountID]; ok {
+			counted, sharedBy := d.conflictShare(recs, recommender.AccountID, recommended.AccountID)
+			if !counted || isExcluded(recs, recommended.AccountID) {
 				continue
 			}
 
-			lastMTLAP, ok := lastDistribute[recommender.AccountID][recommended.AccountID]
-			if !ok {
-				totalNewMTLAP += recommended.MTLAP
+			lastMTLAP, ok := highWater[recommended.AccountID]
+			change := mlm.RewardChange{
+				Recommender: recommender.AccountID,
+				Recommended: recommended.AccountID,
+				LastMTLAP:   lastMTLAP,
+				MTLAP:       recommended.MTLAP,
+				New:         !ok,
+			}
+
+			if sharedBy == 1 {
+				changes = append(changes, change)
 				continue
 			}
-			if lastMTLAP < recommended.MTLAP {
-				totalNewMTLAP += recommended.MTLAP - lastMTLAP
+
+			// Награда за рекомендацию, поделенную между рекомендателями, считается отдельно
+			part, err := d.policyParts([]mlm.RewardChange{change})
+			if err != nil {
+				return nil, err
 			}
+			splitParts.Add(splitParts, part.Quo(part, new(big.Rat).SetInt64(int64(sharedBy))))
 		}
-	}
 
-	if totalNewMTLAP > 0 {
-		res.AmountPerTag = distributeAmount / float64(totalNewMTLAP)
+		var err error
+		parts[i], err = d.policyParts(changes)
+		if err != nil {
+			return nil, err
+		}
+		parts[i].Add(parts[i], splitParts)
+		totalParts.Add(totalParts, parts[i])
 	}
 
 	for recommended, recommenders := range recs.Conflict {
@@ -170,19 +254,29 @@ func (d *Distributor) CalculateParts(
 			res.Conflicts = append(res.Conflicts, db.ReportConflict{
 				Recommender: recoomender,
 				Recommended: recommended,
+				Resolution:  d.conflictResolution(recs, recoomender, recommended),
 			})
 		}
 	}
 
 	for _, recommender := range recs.Recommenders {
-		partCount := int64(0)
-
 		for _, recommended := range recommender.Recommended {
-			if _, ok := recs.Conflict[recommended.AccountID]; ok {
+			if counted, _ := d.conflictShare(recs, recommender.AccountID, recommended.AccountID); !counted {
+				continue
+			}
+
+			res.Recommends = append(res.Recommends, db.ReportRecommend{
+				Recommender:      recommender.AccountID,
+				Recommended:      recommended.AccountID,
+				RecommendedMtlap: recommended.MTLAP,
+			})
+
+			// Рекомендация исключенных сохраняется, чтобы рост MTLAP за время исключения не оплачивался позже
+			if isExcluded(recs, recommender.AccountID) || isExcluded(recs, recommended.AccountID) {
 				continue
 			}
 
-			lastMTLAP, ok := lastDistribute[recommender.AccountID][recommended.AccountID]
+			lastMTLAP, ok := highWater[recommended.AccountID]
 			if !ok {
 				res.RecommendedNewCount++
 			}
@@ -190,7 +284,6 @@ func (d *Distributor) CalculateParts(
 			delta := int64(0)
 			if lastMTLAP < recommended.MTLAP {
 				delta = recommended.MTLAP - lastMTLAP
-				partCount += delta
 				res.RecommendedLevelUpCount++
 			}
 
@@ -200,70 +293,276 @@ func (d *Distributor) CalculateParts(
 					Recommender: recommender.AccountID,
 					Recommended: recommended.AccountID,
 					Delta:       delta,
+					Level:       1,
 				})
 			}
+		}
+	}
 
-			res.Recommends = append(res.Recommends, db.ReportRecommend{
-				Recommender:      recommender.AccountID,
-				Recommended:      recommended.AccountID,
-				RecommendedMtlap: recommended.MTLAP,
-			})
+	// В многоуровневом режиме часть долей уходит вверх по цепочке рекомендаций
+	res.RecommendDeltas = append(res.RecommendDeltas, d.applyMultilevel(recs, parts, res.RecommendDeltas)...)
+
+	for _, b := range budgets {
+		asset, distributes, err := d.calculateAsset(b, recs, parts, totalParts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", b.Budget.Asset.Code, err)
 		}
 
-		amount := math.Floor(float64(partCount)*res.AmountPerTag*10000000) / 10000000
-		if amount > 0 {
-			res.Distributes = append(res.Distributes, db.ReportDistribute{
-				Recommender: recommender.AccountID,
-				Asset:       stellar.LABRAsset,
-				Amount:      amount,
+		res.Assets = append(res.Assets, asset)
+		res.Distributes = append(res.Distributes, distributes...)
+	}
+
+	return res, nil
+}
+
+// calculateAsset делит бюджет одного актива по долям рекомендателей
+func (d *Distributor) calculateAsset(
+	b AssetBudget,
+	recs *mlm.RecommendersFetchResult,
+	parts []*big.Rat,
+	totalParts *big.Rat,
+) (mlm.AssetDistribution, []db.ReportDistribute, error) {
+	res := mlm.AssetDistribution{
+		Asset:     b.Budget.Asset,
+		Budget:    b.Budget,
+		Amount:    b.Amount,
+		Carryover: b.Carryover,
+		Owed:      make([]mlm.Owed, 0),
+	}
+	distributes := make([]db.ReportDistribute, 0, len(recs.Recommenders))
+
+	// Без баланса актив не выплачивается: остаток и долги переходят в следующий отчет
+	if b.NoBalance {
+		accountIDs := lo.Keys(b.Owed)
+		slices.Sort(accountIDs)
+
+		for _, accountID := range accountIDs {
+			res.Owed = append(res.Owed, mlm.Owed{
+				AccountID: accountID,
+				Amount:    new(big.Rat).Set(b.Owed[accountID]),
 			})
 		}
+
+		return res, distributes, nil
 	}
 
-	return res, nil
+	if totalParts.Sign() > 0 {
+		res.AmountPerTag = mulRat(b.Amount, new(big.Rat).Inv(totalParts))
+	}
+
+	withheld := new(big.Rat)
+
+	for i, recommender := range recs.Recommenders {
+		if isExcluded(recs, recommender.AccountID) {
+			withhold(&res, withheld, recommender.AccountID, b.Owed[recommender.AccountID])
+			continue
+		}
+
+		total := new(big.Rat)
+		if o, ok := b.Owed[recommender.AccountID]; ok {
+			total.Add(total, o)
+		}
+		if totalParts.Sign() > 0 {
+			share := new(big.Rat).Mul(new(big.Rat).SetInt64(b.Amount), parts[i])
+			total.Add(total, share.Quo(share, totalParts))
+		}
+
+		addPayout(&res, &distributes, recommender.AccountID, total)
+	}
+
+	// Долги рекомендателям, которых нет среди текущих рекомендателей
+	owedOnly := lo.Filter(lo.Keys(b.Owed), func(accountID string, _ int) bool {
+		return !lo.ContainsBy(recs.Recommenders, func(r mlm.Recommender) bool { return r.AccountID == accountID })
+	})
+	slices.Sort(owedOnly)
+
+	for _, accountID := range owedOnly {
+		if isExcluded(recs, accountID) {
+			withhold(&res, withheld, accountID, b.Owed[accountID])
+			continue
+		}
+
+		addPayout(&res, &distributes, accountID, new(big.Rat).Set(b.Owed[accountID]))
+	}
+
+	d.applyPayoutCap(&res, distributes)
+
+	distributes, pending := d.applyMinPayout(&res, distributes)
+
+	// Выплаты, перенос и новые долги не могут превышать бюджет, его перенос и старые долги
+	budget := new(big.Rat).SetInt64(b.Amount + b.Carryover)
+	for _, o := range b.Owed {
+		budget.Add(budget, o)
+	}
+
+	spent := new(big.Rat).SetInt64(res.Carryover + lo.SumBy(distributes, func(d db.ReportDistribute) int64 { return d.Amount }))
+	owedTotal := new(big.Rat)
+	for _, o := range res.Owed {
+		owedTotal.Add(owedTotal, o.Amount)
+	}
+
+	if spent.Add(spent, owedTotal).Cmp(budget) > 0 {
+		return res, nil, ErrBudgetExceeded
+	}
+
+	// Накопленные до минимальной выплаты суммы целые, остаток от округления — только дробные
+	// части, без удержанных долгов исключенным
+	res.Dust = floorRat(owedTotal.Sub(owedTotal, withheld)) - pending
+
+	return res, distributes, nil
+}
+
+// addPayout добавляет целую часть суммы в выплаты, а дробную — в долги
+func addPayout(res *mlm.AssetDistribution, distributes *[]db.ReportDistribute, accountID string, total *big.Rat) {
+	amount := floorRat(total)
+
+	if amount > 0 {
+		*distributes = append(*distributes, db.ReportDistribute{
+			Recommender: accountID,
+			Asset:       res.Asset.Code,
+			Issuer:      res.Asset.Issuer,
+			Amount:      amount,
+		})
+	}
+
+	if rest := total.Sub(total, new(big.Rat).SetInt64(amount)); rest.Sign() > 0 {
+		res.Owed = append(res.Owed, mlm.Owed{
+			AccountID: accountID,
+			Amount:    rest,
+		})
+	}
 }
 
-func (d *Distributor) getXDR(ctx context.Context, distributes []db.ReportDistribute) (string, error) {
+// withhold оставляет долг исключенному рекомендателю до снятия исключения
+func withhold(res *mlm.AssetDistribution, withheld *big.Rat, accountID string, owed *big.Rat) {
+	if owed == nil || owed.Sign() <= 0 {
+		return
+	}
+
+	withheld.Add(withheld, owed)
+	res.Owed = append(res.Owed, mlm.Owed{
+		AccountID: accountID,
+		Amount:    new(big.Rat).Set(owed),
+	})
+}
+
+// getXDRs разбивает выплаты на транзакции не более чем по maxOperationsPerTransaction операций.
+// Транзакции используют последовательные sequence number и должны отправляться по порядку.
+func (d *Distributor) getXDRs(ctx context.Context, distributes []db.ReportDistribute) ([]string, error) {
 	if len(distributes) == 0 {
-		return "", ErrNoDistributes
+		return nil, ErrNoDistributes
 	}
 
 	accountDetail, err := d.stellar.AccountDetail(d.cfg.Address)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	ops := lo.Map(distributes, func(d db.ReportDistribute, _ int) txnbuild.Operation {
-		return &txnbuild.Payment{
-			Destination: d.Recommender,
-			Amount:      fmt.Sprintf("%.7f", d.Amount),
-			Asset:       txnbuild.CreditAsset{Code: d.Asset, Issuer: stellar.LABRIssuer},
+	chunks := lo.Chunk(distributes, maxOperationsPerTransaction)
+	xdrs := make([]string, 0, len(chunks))
+
+	for i, chunk := range chunks {
+		ops := lo.Map(chunk, func(dist db.ReportDistribute, _ int) txnbuild.Operation {
+			return d.distributeOperation(dist)
+		})
+
+		xdr, err := d.buildXDR(&accountDetail, ops, transactionMemo(time.Now(), i, len(chunks)))
+		if err != nil {
+			return nil, err
 		}
-	})
 
+		xdrs = append(xdrs, xdr)
+	}
+
+	return xdrs, nil
+}
+
+// distributeOperation возвращает операцию выплаты: Payment или, если у получателя
+// нет линии доверия, CreateClaimableBalance, который счет программы вернет себе
+// по истечении ClaimableBalancePeriod
+func (d *Distributor) distributeOperation(dist db.ReportDistribute) txnbuild.Operation {
+	asset := txnbuild.CreditAsset{Code: dist.Asset, Issuer: dist.Issuer}
+
+	if dist.Claimable {
+		return &txnbuild.CreateClaimableBalance{
+			Amount:       amount.StringFromInt64(dist.Amount),
+			Asset:        asset,
+			Destinations: stellar.ClaimableBalanceClaimants(dist.Recommender, d.cfg.Address, d.cfg.ClaimableBalancePeriod),
+		}
+	}
+
+	return &txnbuild.Payment{
+		Destination: dist.Recommender,
+		Amount:      amount.StringFromInt64(dist.Amount),
+		Asset:       asset,
+	}
+}
+
+// transactionMemo возвращает memo транзакции chunk из total транзакций отчета за дату date
+func transactionMemo(date time.Time, chunk, total int) txnbuild.MemoText {
+	memo := fmt.Sprintf("mlta mlm %s", date.Format(time.DateOnly))
+	if total > 1 {
+		memo = fmt.Sprintf("%s %d/%d", memo, chunk+1, total)
+	}
+
+	return txnbuild.MemoText(memo)
+}
+
+// RebuildXDRs пересобирает транзакции с теми же операциями и memo, но с текущим
+// sequence number и новым сроком действия. Нужна, когда транзакция отчета отклонена
+// или истекла: последующие транзакции отчета тоже пересобираются, чтобы sequence
+// number шли подряд.
+func (d *Distributor) RebuildXDRs(ctx context.Context, xdrs []string) ([]string, error) {
+	accountDetail, err := d.stellar.AccountDetail(d.cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(xdrs))
+
+	for _, x := range xdrs {
+		txg, err := txnbuild.TransactionFromXDR(x)
+		if err != nil {
+			return nil, err
+		}
+
+		tx, ok := txg.Transaction()
+		if !ok {
+			return nil, fmt.Errorf("fee bump transactions are not supported")
+		}
+
+		xdr, err := d.buildXDR(&accountDetail, tx.Operations(), tx.Memo())
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, xdr)
+	}
+
+	return res, nil
+}
+
+// buildXDR собирает неподписанную транзакцию, которая действительна TransactionValidity
+// с момента сборки, и увеличивает sequence number source
+func (d *Distributor) buildXDR(source txnbuild.Account, ops []txnbuild.Operation, memo txnbuild.Memo) (string, error) {
 	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
-		SourceAccount:        &accountDetail,
+		SourceAccount:        source,
 		IncrementSequenceNum: true,
 		Operations:           ops,
-		BaseFee:              1000,
-		Memo:                 txnbuild.MemoText(fmt.Sprintf("mlta mlm %s", time.Now().Format(time.DateOnly))),
+		BaseFee:              stellar.TransactionBaseFee,
+		Memo:                 memo,
 		Preconditions: txnbuild.Preconditions{
-			TimeBounds: txnbuild.NewInfiniteTimeout(),
+			TimeBounds: txnbuild.NewTimeout(int64(d.cfg.TransactionValidity.Seconds())),
 		},
 	})
 	if err != nil {
 		return "", err
 	}
 
-	xdr, err := tx.Base64()
-	if err != nil {
-		return "", err
-	}
-
-	return xdr, err
+	return tx.Base64()
 }
 
-func (d *Distributor) createReport(ctx context.Context, res *mlm.DistributeResult) (int64, error) {
+func (d *Distributor) createReport(ctx context.Context, res *mlm.DistributeResult, snapshot *mlm.Snapshot) (int64, error) {
 	tx, err := d.pg.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return 0, err
@@ -272,11 +571,42 @@ func (d *Distributor) createReport(ctx context.Context, res *mlm.DistributeResul
 
 	qtx := d.q.WithTx(tx)
 
-	reportID, err := qtx.CreateReport(ctx, res.XDR)
+	budget, err := json.Marshal(lo.Map(res.Assets, func(a mlm.AssetDistribution, _ int) mlm.Budget { return a.Budget }))
+	if err != nil {
+		return 0, err
+	}
+
+	reportID, err := qtx.CreateReport(ctx, budget)
 	if err != nil {
 		return 0, err
 	}
 
+	if err := d.createSnapshot(ctx, qtx, reportID, snapshot); err != nil {
+		return 0, err
+	}
+
+	if err := d.createCarryover(ctx, qtx, reportID, res.Assets); err != nil {
+		return 0, err
+	}
+
+	if err := d.createArrears(ctx, qtx, reportID, res.Arrears); err != nil {
+		return 0, err
+	}
+
+	if err := d.createExclusions(ctx, qtx, reportID, res.Exclusions); err != nil {
+		return 0, err
+	}
+
+	for i, xdr := range res.XDRs {
+		if err := qtx.CreateReportTransaction(ctx, db.CreateReportTransactionParams{
+			ReportID: reportID,
+			Chunk:    int32(i),
+			Xdr:      xdr,
+		}); err != nil {
+			return 0, err
+		}
+	}
+
 	for _, recommend := range res.Recommends {
 		if err := qtx.CreateReportRecommend(ctx, db.CreateReportRecommendParams{
 			ReportID:         reportID,
@@ -293,7 +623,10 @@ func (d *Distributor) createReport(ctx context.Context, res *mlm.DistributeResul
 			ReportID:    reportID,
 			Recommender: distrib.Recommender,
 			Asset:       distrib.Asset,
+			Issuer:      distrib.Issuer,
 			Amount:      distrib.Amount,
+			Capped:      distrib.Capped,
+			Claimable:   distrib.Claimable,
 		}); err != nil {
 			return 0, err
 		}
@@ -304,6 +637,7 @@ func (d *Distributor) createReport(ctx context.Context, res *mlm.DistributeResul
 			ReportID:    reportID,
 			Recommender: conflict.Recommender,
 			Recommended: conflict.Recommended,
+			Resolution:  conflict.Resolution,
 		}); err != nil {
 			return 0, err
 		}
@@ -315,16 +649,20 @@ func (d *Distributor) createReport(ctx context.Context, res *mlm.DistributeResul
 func (d *Distributor) checkTrustlines(ctx context.Context, distributes []db.ReportDistribute) ([]mlm.MissingTrustline, error) {
 	var missing []mlm.MissingTrustline
 
-	for _, dist := range distributes {
-		has, err := d.stellar.HasTrustline(ctx, dist.Recommender, stellar.LABRAsset, stellar.LABRIssuer)
-		if err != nil {
-			return nil, fmt.Errorf("check trustline for %s: %w", dist.Recommender, err)
-		}
+	keys := lo.Map(distributes, func(dist db.ReportDistribute, _ int) trustline {
+		return trustline{dist.Recommender, mlm.Asset{Code: dist.Asset, Issuer: dist.Issuer}}
+	})
 
-		if !has {
+	has, err := d.lookupTrustlines(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		if !has[key] {
 			missing = append(missing, mlm.MissingTrustline{
-				AccountID: dist.Recommender,
-				Asset:     stellar.LABRAsset,
+				AccountID: key.accountID,
+				Asset:     key.asset,
 			})
 		}
 	}
@@ -332,17 +670,72 @@ func (d *Distributor) checkTrustlines(ctx context.Context, distributes []db.Repo
 	return missing, nil
 }
 
+// lookupTrustlines проверяет линии доверия параллельно, не больше HorizonConcurrency
+// запросов одновременно. После первой ошибки новые проверки не запускаются.
+func (d *Distributor) lookupTrustlines(ctx context.Context, keys []trustline) (map[trustline]bool, error) {
+	keys = lo.Uniq(keys)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	has := make([]bool, len(keys))
+	errs := make([]error, len(keys))
+	sem := make(chan struct{}, max(d.cfg.HorizonConcurrency, 1))
+
+	var wg sync.WaitGroup
+
+	for i, key := range keys {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			has[i], errs[i] = d.stellar.HasTrustline(ctx, key.accountID, key.asset.Code, key.asset.Issuer)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("check %s trustline for %s: %w", key.asset.Code, key.accountID, errs[i])
+				cancel()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	res := make(map[trustline]bool, len(keys))
+	for i, key := range keys {
+		res[key] = has[i]
+	}
+
+	return res, nil
+}
+
 func New(
 	cfg *config.Config,
 	stellar mlm.StellarAgregator,
 	q *db.Queries,
-	pg *pgx.Conn,
+	pg TxBeginner,
+	policy mlm.RewardPolicy,
 ) *Distributor {
 	return &Distributor{
 		cfg:     cfg,
 		stellar: stellar,
 		q:       q,
 		pg:      pg,
+		policy:  policy,
 	}
 }
 
@@ -1,27 +1,41 @@
 package distributor_test
 
 import (
+	"context"
+	"math/big"
 	"testing"
 
 	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/config"
+	"github.com/mtlprog/mlm/db"
 	"github.com/mtlprog/mlm/distributor"
+	"github.com/mtlprog/mlm/stellar"
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/keypair"
 	"github.com/stretchr/testify/require"
 )
 
+type calculatePartsWant struct {
+	AmountPerTag            int64
+	RecommendedNewCount     int64
+	RecommendedLevelUpCount int64
+	RecommendDeltas         []mlm.RecommendDelta
+}
+
 func TestCalculateParts(t *testing.T) {
-	d := &distributor.Distributor{}
+	d := newDistributor(&config.Config{})
 
 	tests := []struct {
 		name             string
-		lastDistribute   map[string]map[string]int64
-		distributeAmount float64
+		highWater        map[string]int64
+		distributeAmount int64
 		recs             *mlm.RecommendersFetchResult
-		want             *mlm.DistributeResult
+		want             *calculatePartsWant
 	}{
 		{
 			name:             "новые MTLAP",
-			lastDistribute:   map[string]map[string]int64{},
-			distributeAmount: 100,
+			highWater:        map[string]int64{},
+			distributeAmount: 100 * amount.One,
 			recs: &mlm.RecommendersFetchResult{
 				Recommenders: []mlm.Recommender{
 					{
@@ -34,25 +48,23 @@ func TestCalculateParts(t *testing.T) {
 				},
 				Conflict: map[string][]string{},
 			},
-			want: &mlm.DistributeResult{
-				AmountPerTag:            100.0 / 30.0, // 100 / (10 + 20)
+			want: &calculatePartsWant{
+				AmountPerTag:            100 * amount.One / 30, // 100 / (10 + 20)
 				RecommendedNewCount:     2,
 				RecommendedLevelUpCount: 2,
 				RecommendDeltas: []mlm.RecommendDelta{
-					{Recommender: "rec1", Recommended: "user1", Delta: 10},
-					{Recommender: "rec1", Recommended: "user2", Delta: 20},
+					{Recommender: "rec1", Recommended: "user1", Delta: 10, Level: 1},
+					{Recommender: "rec1", Recommended: "user2", Delta: 20, Level: 1},
 				},
 			},
 		},
 		{
 			name: "измененные MTLAP",
-			lastDistribute: map[string]map[string]int64{
-				"rec1": {
-					"user1": 5,
-					"user2": 10,
-				},
+			highWater: map[string]int64{
+				"user1": 5,
+				"user2": 10,
 			},
-			distributeAmount: 100,
+			distributeAmount: 100 * amount.One,
 			recs: &mlm.RecommendersFetchResult{
 				Recommenders: []mlm.Recommender{
 					{
@@ -65,20 +77,20 @@ func TestCalculateParts(t *testing.T) {
 				},
 				Conflict: map[string][]string{},
 			},
-			want: &mlm.DistributeResult{
-				AmountPerTag:            100.0 / 15.0, // 100 / (5 + 10)
+			want: &calculatePartsWant{
+				AmountPerTag:            100 * amount.One / 15, // 100 / (5 + 10)
 				RecommendedNewCount:     0,
 				RecommendedLevelUpCount: 2,
 				RecommendDeltas: []mlm.RecommendDelta{
-					{Recommender: "rec1", Recommended: "user1", Delta: 5},
-					{Recommender: "rec1", Recommended: "user2", Delta: 10},
+					{Recommender: "rec1", Recommended: "user1", Delta: 5, Level: 1},
+					{Recommender: "rec1", Recommended: "user2", Delta: 10, Level: 1},
 				},
 			},
 		},
 		{
 			name:             "игнорирование конфликтов",
-			lastDistribute:   map[string]map[string]int64{},
-			distributeAmount: 100,
+			highWater:        map[string]int64{},
+			distributeAmount: 100 * amount.One,
 			recs: &mlm.RecommendersFetchResult{
 				Recommenders: []mlm.Recommender{
 					{
@@ -93,24 +105,22 @@ func TestCalculateParts(t *testing.T) {
 					"user1": {"rec1", "rec2"},
 				},
 			},
-			want: &mlm.DistributeResult{
-				AmountPerTag:            100.0 / 20.0, // 100 / 20 (user1 в конфликте)
+			want: &calculatePartsWant{
+				AmountPerTag:            100 * amount.One / 20, // 100 / 20 (user1 в конфликте)
 				RecommendedNewCount:     1,
 				RecommendedLevelUpCount: 1,
 				RecommendDeltas: []mlm.RecommendDelta{
-					{Recommender: "rec1", Recommended: "user2", Delta: 20},
+					{Recommender: "rec1", Recommended: "user2", Delta: 20, Level: 1},
 				},
 			},
 		},
 		{
 			name: "игнорирование нулевых сумм",
-			lastDistribute: map[string]map[string]int64{
-				"rec1": {
-					"user1": 10,
-					"user2": 20,
-				},
+			highWater: map[string]int64{
+				"user1": 10,
+				"user2": 20,
 			},
-			distributeAmount: 100,
+			distributeAmount: 100 * amount.One,
 			recs: &mlm.RecommendersFetchResult{
 				Recommenders: []mlm.Recommender{
 					{
@@ -123,23 +133,540 @@ func TestCalculateParts(t *testing.T) {
 				},
 				Conflict: map[string][]string{},
 			},
-			want: &mlm.DistributeResult{
+			want: &calculatePartsWant{
 				AmountPerTag:            0,
 				RecommendedNewCount:     0,
 				RecommendedLevelUpCount: 0,
 				RecommendDeltas:         []mlm.RecommendDelta{},
 			},
 		},
+		{
+			name: "MTLAP ниже исторического максимума",
+			highWater: map[string]int64{
+				"user1": 10, // был у другого рекомендателя
+				"user2": 20, // MTLAP упал и вернулся
+			},
+			distributeAmount: 100 * amount.One,
+			recs: &mlm.RecommendersFetchResult{
+				Recommenders: []mlm.Recommender{
+					{
+						AccountID: "rec1",
+						Recommended: []mlm.Recommended{
+							{AccountID: "user1", MTLAP: 12}, // +2 сверх максимума
+							{AccountID: "user2", MTLAP: 15},
+						},
+					},
+				},
+				Conflict: map[string][]string{},
+			},
+			want: &calculatePartsWant{
+				AmountPerTag:            100 * amount.One / 2,
+				RecommendedNewCount:     0,
+				RecommendedLevelUpCount: 1,
+				RecommendDeltas: []mlm.RecommendDelta{
+					{Recommender: "rec1", Recommended: "user1", Delta: 2, Level: 1},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := d.CalculateParts(tt.lastDistribute, tt.distributeAmount, tt.recs)
+			got, err := d.CalculateParts(tt.highWater, labrBudget(tt.distributeAmount, nil), tt.recs)
 			require.NoError(t, err)
-			require.InDelta(t, tt.want.AmountPerTag, got.AmountPerTag, 0.0001)
+			require.Equal(t, tt.want.AmountPerTag, got.Assets[0].AmountPerTag)
 			require.Equal(t, tt.want.RecommendedNewCount, got.RecommendedNewCount)
 			require.Equal(t, tt.want.RecommendedLevelUpCount, got.RecommendedLevelUpCount)
 			require.Equal(t, tt.want.RecommendDeltas, got.RecommendDeltas)
 		})
 	}
 }
+
+func TestCalculatePartsPayoutCap(t *testing.T) {
+	recs := &mlm.RecommendersFetchResult{
+		Recommenders: []mlm.Recommender{
+			{AccountID: "rec1", Recommended: []mlm.Recommended{{AccountID: "user1", MTLAP: 8}}},
+			{AccountID: "rec2", Recommended: []mlm.Recommended{{AccountID: "user2", MTLAP: 1}}},
+			{AccountID: "rec3", Recommended: []mlm.Recommended{{AccountID: "user3", MTLAP: 1}}},
+		},
+		Conflict: map[string][]string{},
+	}
+
+	tests := []struct {
+		name          string
+		cfg           *config.Config
+		wantAmounts   []int64
+		wantCapped    []int64
+		wantCarryover int64
+	}{
+		{
+			name:          "перераспределение излишка",
+			cfg:           &config.Config{PayoutCap: 50 * amount.One, PayoutCapExcess: config.PayoutCapExcessRedistribute},
+			wantAmounts:   []int64{50 * amount.One, 25 * amount.One, 25 * amount.One},
+			wantCapped:    []int64{30 * amount.One, 0, 0},
+			wantCarryover: 0,
+		},
+		{
+			name:          "перенос излишка",
+			cfg:           &config.Config{PayoutCapShare: 50, PayoutCapExcess: config.PayoutCapExcessCarryover},
+			wantAmounts:   []int64{50 * amount.One, 10 * amount.One, 10 * amount.One},
+			wantCapped:    []int64{30 * amount.One, 0, 0},
+			wantCarryover: 30 * amount.One,
+		},
+		{
+			name:          "некому перераспределить",
+			cfg:           &config.Config{PayoutCap: 5 * amount.One, PayoutCapExcess: config.PayoutCapExcessRedistribute},
+			wantAmounts:   []int64{5 * amount.One, 5 * amount.One, 5 * amount.One},
+			wantCapped:    []int64{75 * amount.One, 5 * amount.One, 5 * amount.One},
+			wantCarryover: 85 * amount.One,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDistributor(tt.cfg)
+
+			got, err := d.CalculateParts(map[string]int64{}, labrBudget(100*amount.One, nil), recs)
+			require.NoError(t, err)
+			require.Len(t, got.Distributes, len(tt.wantAmounts))
+
+			for i, dist := range got.Distributes {
+				require.Equal(t, tt.wantAmounts[i], dist.Amount)
+				require.Equal(t, tt.wantCapped[i], dist.Capped)
+			}
+			require.Equal(t, tt.wantCarryover, got.Assets[0].Carryover)
+		})
+	}
+}
+
+func TestCalculatePartsNeverExceedsBudget(t *testing.T) {
+	d := newDistributor(&config.Config{})
+
+	recs := &mlm.RecommendersFetchResult{
+		Recommenders: []mlm.Recommender{
+			{AccountID: "rec1", Recommended: []mlm.Recommended{{AccountID: "user1", MTLAP: 1}}},
+			{AccountID: "rec2", Recommended: []mlm.Recommended{{AccountID: "user2", MTLAP: 1}}},
+			{AccountID: "rec3", Recommended: []mlm.Recommended{{AccountID: "user3", MTLAP: 1}}},
+		},
+		Conflict: map[string][]string{},
+	}
+
+	got, err := d.CalculateParts(map[string]int64{}, labrBudget(100, nil), recs)
+	require.NoError(t, err)
+	require.Len(t, got.Distributes, 3)
+
+	for _, dist := range got.Distributes {
+		require.Equal(t, int64(33), dist.Amount)
+	}
+	require.Equal(t, int64(1), got.Assets[0].Dust)
+
+	// Дробные доли переходят в долги и выплачиваются в следующем отчете
+	require.Len(t, got.Assets[0].Owed, 3)
+	for _, o := range got.Assets[0].Owed {
+		require.Equal(t, big.NewRat(1, 3), o.Amount)
+	}
+}
+
+func TestCalculatePartsOwed(t *testing.T) {
+	d := newDistributor(&config.Config{})
+
+	recs := &mlm.RecommendersFetchResult{
+		Recommenders: []mlm.Recommender{
+			{AccountID: "rec1", Recommended: []mlm.Recommended{{AccountID: "user1", MTLAP: 1}}},
+			{AccountID: "rec2", Recommended: []mlm.Recommended{{AccountID: "user2", MTLAP: 2}}},
+		},
+		Conflict: map[string][]string{},
+	}
+
+	owed := map[string]*big.Rat{
+		"rec1": big.NewRat(2, 3),
+		"rec9": big.NewRat(5, 1),
+	}
+
+	got, err := d.CalculateParts(map[string]int64{}, labrBudget(100, owed), recs)
+	require.NoError(t, err)
+	require.Equal(t, []db.ReportDistribute{
+		{Recommender: "rec1", Asset: stellar.LABRAsset, Issuer: stellar.LABRIssuer, Amount: 34}, // 33 1/3 + 2/3
+		{Recommender: "rec2", Asset: stellar.LABRAsset, Issuer: stellar.LABRIssuer, Amount: 66},
+		{Recommender: "rec9", Asset: stellar.LABRAsset, Issuer: stellar.LABRIssuer, Amount: 5},
+	}, got.Distributes)
+	require.Len(t, got.Assets[0].Owed, 1)
+	require.Equal(t, "rec2", got.Assets[0].Owed[0].AccountID)
+	require.Equal(t, big.NewRat(2, 3), got.Assets[0].Owed[0].Amount)
+}
+
+func TestCalculatePartsConflictPolicy(t *testing.T) {
+	newRecs := func(winners map[string]string) *mlm.RecommendersFetchResult {
+		return &mlm.RecommendersFetchResult{
+			Recommenders: []mlm.Recommender{
+				{AccountID: "rec1", Recommended: []mlm.Recommended{{AccountID: "user1", MTLAP: 10}}},
+				{AccountID: "rec2", Recommended: []mlm.Recommended{
+					{AccountID: "user1", MTLAP: 10},
+					{AccountID: "user2", MTLAP: 10},
+				}},
+			},
+			Conflict:        map[string][]string{"user1": {"rec1", "rec2"}},
+			ConflictWinners: winners,
+		}
+	}
+
+	tests := []struct {
+		name           string
+		policy         string
+		winners        map[string]string
+		wantAmounts    map[string]int64
+		wantResolution map[string]string
+	}{
+		{
+			name:           "пропуск",
+			policy:         config.ConflictPolicySkip,
+			wantAmounts:    map[string]int64{"rec2": 100 * amount.One},
+			wantResolution: map[string]string{"rec1": mlm.ConflictResolutionSkip, "rec2": mlm.ConflictResolutionSkip},
+		},
+		{
+			name:           "поровну",
+			policy:         config.ConflictPolicySplit,
+			wantAmounts:    map[string]int64{"rec1": 25 * amount.One, "rec2": 75 * amount.One}, // 5 и 5 + 10
+			wantResolution: map[string]string{"rec1": mlm.ConflictResolutionSplit, "rec2": mlm.ConflictResolutionSplit},
+		},
+		{
+			name:           "выбранный рекомендатель",
+			policy:         config.ConflictPolicyManual,
+			winners:        map[string]string{"user1": "rec1"},
+			wantAmounts:    map[string]int64{"rec1": 50 * amount.One, "rec2": 50 * amount.One},
+			wantResolution: map[string]string{"rec1": mlm.ConflictResolutionWon, "rec2": mlm.ConflictResolutionLost},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDistributor(&config.Config{ConflictPolicy: tt.policy})
+
+			got, err := d.CalculateParts(map[string]int64{}, labrBudget(100*amount.One, nil), newRecs(tt.winners))
+			require.NoError(t, err)
+
+			amounts := make(map[string]int64)
+			for _, dist := range got.Distributes {
+				amounts[dist.Recommender] = dist.Amount
+			}
+			require.Equal(t, tt.wantAmounts, amounts)
+
+			resolutions := make(map[string]string)
+			for _, c := range got.Conflicts {
+				resolutions[c.Recommender] = c.Resolution
+			}
+			require.Equal(t, tt.wantResolution, resolutions)
+		})
+	}
+}
+
+func TestCalculatePartsMultiAsset(t *testing.T) {
+	d := newDistributor(&config.Config{})
+
+	recs := &mlm.RecommendersFetchResult{
+		Recommenders: []mlm.Recommender{
+			{AccountID: "rec1", Recommended: []mlm.Recommended{{AccountID: "user1", MTLAP: 1}}},
+			{AccountID: "rec2", Recommended: []mlm.Recommended{{AccountID: "user2", MTLAP: 3}}},
+		},
+		Conflict: map[string][]string{},
+	}
+
+	eurmtl := mlm.Asset{Code: stellar.EURMTLAsset, Issuer: stellar.EURMTLIssuer}
+	budgets := append(labrBudget(100*amount.One, nil), distributor.AssetBudget{
+		Budget: mlm.Budget{Asset: eurmtl},
+		Amount: 10 * amount.One,
+	})
+
+	got, err := d.CalculateParts(map[string]int64{}, budgets, recs)
+	require.NoError(t, err)
+	require.Len(t, got.Assets, 2)
+	require.Equal(t, eurmtl, got.Assets[1].Asset)
+	require.Equal(t, []db.ReportDistribute{
+		{Recommender: "rec1", Asset: stellar.LABRAsset, Issuer: stellar.LABRIssuer, Amount: 25 * amount.One},
+		{Recommender: "rec2", Asset: stellar.LABRAsset, Issuer: stellar.LABRIssuer, Amount: 75 * amount.One},
+		{Recommender: "rec1", Asset: stellar.EURMTLAsset, Issuer: stellar.EURMTLIssuer, Amount: 25 * amount.One / 10},
+		{Recommender: "rec2", Asset: stellar.EURMTLAsset, Issuer: stellar.EURMTLIssuer, Amount: 75 * amount.One / 10},
+	}, got.Distributes)
+}
+
+func TestCalculatePartsNoBalanceAsset(t *testing.T) {
+	d := newDistributor(&config.Config{})
+
+	recs := &mlm.RecommendersFetchResult{
+		Recommenders: []mlm.Recommender{
+			{AccountID: "rec1", Recommended: []mlm.Recommended{{AccountID: "user1", MTLAP: 1}}},
+		},
+		Conflict: map[string][]string{},
+	}
+
+	eurmtl := mlm.Asset{Code: stellar.EURMTLAsset, Issuer: stellar.EURMTLIssuer}
+	budgets := append(labrBudget(100*amount.One, nil), distributor.AssetBudget{
+		Budget:    mlm.Budget{Asset: eurmtl},
+		Carryover: 3 * amount.One,
+		Owed:      map[string]*big.Rat{"rec1": big.NewRat(5*amount.One, 1)},
+		NoBalance: true,
+	})
+
+	got, err := d.CalculateParts(map[string]int64{}, budgets, recs)
+	require.NoError(t, err)
+	require.Equal(t, []db.ReportDistribute{
+		{Recommender: "rec1", Asset: stellar.LABRAsset, Issuer: stellar.LABRIssuer, Amount: 100 * amount.One},
+	}, got.Distributes)
+
+	// Актив без баланса не выплачивается, остаток и долги переходят в следующий отчет
+	require.Equal(t, int64(3*amount.One), got.Assets[1].Carryover)
+	require.Equal(t, []mlm.Owed{{AccountID: "rec1", Amount: big.NewRat(5*amount.One, 1)}}, got.Assets[1].Owed)
+}
+
+func TestCalculatePartsMultilevel(t *testing.T) {
+	chain := &mlm.RecommendersFetchResult{
+		Recommenders: []mlm.Recommender{
+			{AccountID: "top", Recommended: []mlm.Recommended{{AccountID: "mid", MTLAP: 10}}},
+			{AccountID: "mid", Recommended: []mlm.Recommended{{AccountID: "low", MTLAP: 10}}},
+			{AccountID: "low", Recommended: []mlm.Recommended{{AccountID: "user", MTLAP: 100}}},
+		},
+		Conflict: map[string][]string{},
+	}
+	chainHighWater := map[string]int64{"mid": 10, "low": 10}
+
+	excludedMid := &mlm.RecommendersFetchResult{
+		Recommenders: chain.Recommenders,
+		Conflict:     map[string][]string{},
+		Excluded:     map[string]string{"mid": "flagged"},
+	}
+
+	cycle := &mlm.RecommendersFetchResult{
+		Recommenders: []mlm.Recommender{
+			{AccountID: "a", Recommended: []mlm.Recommended{{AccountID: "b", MTLAP: 10}}},
+			{AccountID: "b", Recommended: []mlm.Recommended{{AccountID: "a", MTLAP: 10}}},
+		},
+		Conflict: map[string][]string{},
+	}
+
+	tests := []struct {
+		name        string
+		maxDepth    int
+		highWater   map[string]int64
+		recs        *mlm.RecommendersFetchResult
+		wantAmounts map[string]int64
+		wantDeltas  []mlm.RecommendDelta
+	}{
+		{
+			name:        "цепочка",
+			highWater:   chainHighWater,
+			recs:        chain,
+			wantAmounts: map[string]int64{"low": 85 * amount.One, "mid": 10 * amount.One, "top": 5 * amount.One},
+			wantDeltas: []mlm.RecommendDelta{
+				{Recommender: "low", Recommended: "user", Delta: 100, Level: 1},
+				{Recommender: "mid", Recommended: "user", Delta: 100, Level: 2, Via: "low"},
+				{Recommender: "top", Recommended: "user", Delta: 100, Level: 3, Via: "low"},
+			},
+		},
+		{
+			name:        "максимальная глубина",
+			maxDepth:    2,
+			highWater:   chainHighWater,
+			recs:        chain,
+			wantAmounts: map[string]int64{"low": 90 * amount.One, "mid": 10 * amount.One},
+			wantDeltas: []mlm.RecommendDelta{
+				{Recommender: "low", Recommended: "user", Delta: 100, Level: 1},
+				{Recommender: "mid", Recommended: "user", Delta: 100, Level: 2, Via: "low"},
+			},
+		},
+		{
+			name:        "исключенный уровень пропускается",
+			highWater:   chainHighWater,
+			recs:        excludedMid,
+			wantAmounts: map[string]int64{"low": 90 * amount.One, "top": 10 * amount.One},
+			wantDeltas: []mlm.RecommendDelta{
+				{Recommender: "low", Recommended: "user", Delta: 100, Level: 1},
+				{Recommender: "top", Recommended: "user", Delta: 100, Level: 2, Via: "low"},
+			},
+		},
+		{
+			name:        "цикл",
+			highWater:   map[string]int64{},
+			recs:        cycle,
+			wantAmounts: map[string]int64{"a": 50 * amount.One, "b": 50 * amount.One},
+			wantDeltas: []mlm.RecommendDelta{
+				{Recommender: "a", Recommended: "b", Delta: 10, Level: 1},
+				{Recommender: "b", Recommended: "a", Delta: 10, Level: 1},
+				{Recommender: "b", Recommended: "b", Delta: 10, Level: 2, Via: "a"},
+				{Recommender: "a", Recommended: "a", Delta: 10, Level: 2, Via: "b"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDistributor(&config.Config{
+				MultilevelShares:   []float64{10, 5},
+				MultilevelMaxDepth: tt.maxDepth,
+			})
+
+			got, err := d.CalculateParts(tt.highWater, labrBudget(100*amount.One, nil), tt.recs)
+			require.NoError(t, err)
+
+			amounts := make(map[string]int64)
+			for _, dist := range got.Distributes {
+				amounts[dist.Recommender] = dist.Amount
+			}
+			require.Equal(t, tt.wantAmounts, amounts)
+			require.Equal(t, tt.wantDeltas, got.RecommendDeltas)
+		})
+	}
+}
+
+func TestCalculatePartsMinPayout(t *testing.T) {
+	d := newDistributor(&config.Config{MinPayout: 10})
+
+	recs := &mlm.RecommendersFetchResult{
+		Recommenders: []mlm.Recommender{
+			{AccountID: "rec1", Recommended: []mlm.Recommended{{AccountID: "user1", MTLAP: 1}}},
+			{AccountID: "rec2", Recommended: []mlm.Recommended{{AccountID: "user2", MTLAP: 2}}},
+			{AccountID: "rec3", Recommended: []mlm.Recommended{{AccountID: "user3", MTLAP: 17}}},
+		},
+		Conflict: map[string][]string{},
+	}
+
+	// rec1 накопил 8 1/2 в прошлых отчетах и вместе с новой наградой достигает минимума
+	owed := map[string]*big.Rat{"rec1": big.NewRat(17, 2)}
+
+	got, err := d.CalculateParts(map[string]int64{}, labrBudget(40, owed), recs)
+	require.NoError(t, err)
+	require.Equal(t, []db.ReportDistribute{
+		{Recommender: "rec1", Asset: stellar.LABRAsset, Issuer: stellar.LABRIssuer, Amount: 10}, // 8 1/2 + 2
+		{Recommender: "rec3", Asset: stellar.LABRAsset, Issuer: stellar.LABRIssuer, Amount: 34},
+	}, got.Distributes)
+
+	asset := got.Assets[0]
+	require.Equal(t, int64(10), asset.MinPayout)
+	require.Equal(t, []mlm.Owed{
+		{AccountID: "rec1", Amount: big.NewRat(1, 2)},
+		{AccountID: "rec2", Amount: big.NewRat(4, 1)},
+	}, asset.Owed)
+	require.Equal(t, int64(0), asset.Dust)
+}
+
+func TestApplyVesting(t *testing.T) {
+	snapshot := func(balances map[string]string) *mlm.Snapshot {
+		s := &mlm.Snapshot{}
+		for accountID, mtlap := range balances {
+			s.Accounts = append(s.Accounts, mlm.SnapshotAccount{AccountID: accountID, MTLAP: mtlap})
+		}
+		return s
+	}
+
+	// user1 держит 10 MTLAP оба отчета, user2 купил 5 только в последнем, user3 новый
+	vested := distributor.VestedMTLAP([]*mlm.Snapshot{
+		snapshot(map[string]string{"user1": "10.0000000", "user2": "5.0000000"}),
+		snapshot(map[string]string{"user1": "12.0000000", "user2": "0.0000000"}),
+	})
+
+	recs := &mlm.RecommendersFetchResult{
+		Recommenders: []mlm.Recommender{
+			{AccountID: "rec1", Recommended: []mlm.Recommended{
+				{AccountID: "user1", MTLAP: 15},
+				{AccountID: "user2", MTLAP: 5},
+				{AccountID: "user3", MTLAP: 7},
+			}},
+		},
+		Conflict: map[string][]string{},
+	}
+
+	pending := distributor.ApplyVesting(recs, map[string]int64{"user1": 8, "user2": 0}, vested)
+
+	require.Equal(t, []mlm.Recommended{
+		{AccountID: "user1", MTLAP: 10},
+		{AccountID: "user2", MTLAP: 0},
+	}, recs.Recommenders[0].Recommended)
+
+	require.Equal(t, []mlm.RecommendDelta{
+		{Recommender: "rec1", Recommended: "user1", Delta: 5, Level: 1},
+		{Recommender: "rec1", Recommended: "user2", Delta: 5, Level: 1},
+		{Recommender: "rec1", Recommended: "user3", Delta: 7, Level: 1},
+	}, pending)
+}
+
+func TestCalculatePartsExclusions(t *testing.T) {
+	d := newDistributor(&config.Config{})
+
+	recs := &mlm.RecommendersFetchResult{
+		Recommenders: []mlm.Recommender{
+			{AccountID: "rec1", Recommended: []mlm.Recommended{{AccountID: "user1", MTLAP: 10}}},
+			{AccountID: "rec2", Recommended: []mlm.Recommended{
+				{AccountID: "user2", MTLAP: 10},
+				{AccountID: "bad", MTLAP: 30},
+			}},
+			{AccountID: "evil", Recommended: []mlm.Recommended{{AccountID: "user3", MTLAP: 50}}},
+		},
+		Conflict: map[string][]string{},
+		Excluded: map[string]string{"bad": "compromised keys", "evil": "governance"},
+	}
+
+	owed := map[string]*big.Rat{"evil": big.NewRat(7, 2)}
+
+	got, err := d.CalculateParts(map[string]int64{}, labrBudget(100, owed), recs)
+	require.NoError(t, err)
+
+	require.Equal(t, []db.ReportDistribute{
+		{Recommender: "rec1", Asset: stellar.LABRAsset, Issuer: stellar.LABRIssuer, Amount: 50},
+		{Recommender: "rec2", Asset: stellar.LABRAsset, Issuer: stellar.LABRIssuer, Amount: 50},
+	}, got.Distributes)
+
+	// Рекомендации исключенных сохраняются, чтобы их рост MTLAP не оплачивался позже
+	require.Len(t, got.Recommends, 4)
+	require.Equal(t, int64(2), got.RecommendedNewCount)
+
+	require.Equal(t, []mlm.Owed{{AccountID: "evil", Amount: big.NewRat(7, 2)}}, got.Assets[0].Owed)
+	require.Equal(t, int64(0), got.Assets[0].Dust)
+
+	require.Equal(t, []db.ReportExclusion{
+		{AccountID: "bad", Reason: "compromised keys"},
+		{AccountID: "evil", Reason: "governance"},
+	}, got.Exclusions)
+}
+
+func TestDistributeCreatesReport(t *testing.T) {
+	recs := recommenders(101)
+
+	st := &fakeStellar{
+		balances: map[string]string{stellar.LABRAsset: "1000"},
+		recs:     func() *mlm.RecommendersFetchResult { return &mlm.RecommendersFetchResult{Recommenders: recs} },
+		sequence: 10,
+	}
+
+	cfg := dbConfig(keypair.MustRandom().Address())
+	cfg.RewardAssets[0].BudgetAmount = 101 * amount.One
+
+	d, fdb := newDBDistributor(t, cfg, st)
+	fdb.on("CreateReport", int64(7))
+
+	res, err := d.Distribute(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(7), res.ReportID)
+	require.Len(t, res.XDRs, 2)
+
+	require.True(t, fdb.committed)
+	require.Len(t, fdb.called("LockReport"), 1)
+	require.Len(t, fdb.called("UnlockReport"), 1)
+
+	txs := fdb.called("CreateReportTransaction")
+	require.Len(t, txs, 2)
+	for i, c := range txs {
+		require.True(t, c.Tx, "транзакция отчета сохраняется вместе с отчетом")
+		require.Equal(t, []any{int64(7), int32(i), res.XDRs[i]}, c.Args)
+	}
+
+	distributes := fdb.called("CreateReportDistribute")
+	require.Len(t, distributes, 101)
+	for i, c := range distributes {
+		require.True(t, c.Tx)
+		require.Equal(t, int64(7), c.Args[0])
+		require.Equal(t, recs[i].AccountID, c.Args[1])
+		require.Equal(t, int64(amount.One), c.Args[4])
+	}
+
+	require.Len(t, fdb.called("CreateReportRecommend"), 101)
+	require.Empty(t, fdb.called("CreateArrear"))
+}
@@ -0,0 +1,59 @@
+package distributor
+
+import (
+	"context"
+	"slices"
+
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/db"
+	"github.com/samber/lo"
+)
+
+// loadExclusions добавляет в recs действующие исключения из базы
+func (d *Distributor) loadExclusions(ctx context.Context, recs *mlm.RecommendersFetchResult) error {
+	rows, err := d.q.GetActiveExclusions(ctx)
+	if err != nil {
+		return err
+	}
+
+	recs.Excluded = lo.SliceToMap(rows, func(row db.Exclusion) (string, string) {
+		return row.AccountID, row.Reason
+	})
+
+	return nil
+}
+
+// isExcluded возвращает, отстранен ли счет от наград. Исключенный рекомендатель
+// не получает награду и не передает ее вверх по цепочке, а рост MTLAP исключенного
+// рекомендуемого никому не приносит награды.
+func isExcluded(recs *mlm.RecommendersFetchResult, accountID string) bool {
+	_, ok := recs.Excluded[accountID]
+	return ok
+}
+
+// reportExclusions возвращает исключения для сохранения в отчете
+func reportExclusions(recs *mlm.RecommendersFetchResult) []db.ReportExclusion {
+	accounts := lo.Keys(recs.Excluded)
+	slices.Sort(accounts)
+
+	return lo.Map(accounts, func(accountID string, _ int) db.ReportExclusion {
+		return db.ReportExclusion{
+			AccountID: accountID,
+			Reason:    recs.Excluded[accountID],
+		}
+	})
+}
+
+func (d *Distributor) createExclusions(ctx context.Context, q *db.Queries, reportID int64, exclusions []db.ReportExclusion) error {
+	for _, e := range exclusions {
+		if err := q.CreateReportExclusion(ctx, db.CreateReportExclusionParams{
+			ReportID:  reportID,
+			AccountID: e.AccountID,
+			Reason:    e.Reason,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
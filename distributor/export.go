@@ -0,0 +1,195 @@
+package distributor
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mtlprog/mlm/db"
+	"github.com/stellar/go/txnbuild"
+)
+
+// Строки файла выгрузки, по которым читаются подписанные транзакции
+const (
+	exportReportHashPrefix = "report hash: "
+	exportXDRPrefix        = "xdr: "
+)
+
+// Export — неподписанные транзакции отчета с описанием операций для подписи
+// на отдельной машине
+type Export struct {
+	ReportID     int64
+	ReportHash   string
+	Network      string
+	Transactions []ExportTransaction
+}
+
+// ExportTransaction — транзакция отчета в выгрузке. ValidUntil нулевой
+// у транзакций без срока действия.
+type ExportTransaction struct {
+	Chunk      int32
+	Total      int
+	Hash       string
+	Source     string
+	Sequence   int64
+	ValidUntil time.Time
+	Operations []string
+	XDR        string
+}
+
+// ReportHash возвращает sha256 неподписанных XDR транзакций по порядку. Хэш меняется,
+// если транзакции пересобраны или часть из них уже выполнена, поэтому подписи
+// к устаревшей выгрузке не примутся.
+func ReportHash(txs []db.ReportTransaction) string {
+	h := sha256.New()
+	for _, t := range txs {
+		h.Write([]byte(t.Xdr))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// NewExport описывает неподписанные транзакции отчета txs. total — число всех транзакций
+// отчета: после частичной отправки выгружаются не все, а номер транзакции сквозной.
+func NewExport(reportID int64, network string, total int, txs []db.ReportTransaction) (Export, error) {
+	e := Export{
+		ReportID:   reportID,
+		ReportHash: ReportHash(txs),
+		Network:    network,
+	}
+
+	for _, t := range txs {
+		gtx, err := txnbuild.TransactionFromXDR(t.Xdr)
+		if err != nil {
+			return Export{}, fmt.Errorf("decode transaction %d: %w", t.Chunk+1, err)
+		}
+
+		tx, ok := gtx.Transaction()
+		if !ok {
+			return Export{}, fmt.Errorf("transaction %d is a fee bump transaction", t.Chunk+1)
+		}
+
+		hash, err := tx.HashHex(network)
+		if err != nil {
+			return Export{}, err
+		}
+
+		et := ExportTransaction{
+			Chunk:    t.Chunk,
+			Total:    total,
+			Hash:     hash,
+			Source:   tx.SourceAccount().AccountID,
+			Sequence: tx.SequenceNumber(),
+			XDR:      t.Xdr,
+		}
+
+		if maxTime := tx.Timebounds().MaxTime; maxTime != 0 {
+			et.ValidUntil = time.Unix(maxTime, 0).UTC()
+		}
+
+		for _, op := range tx.Operations() {
+			et.Operations = append(et.Operations, describeOperation(op))
+		}
+
+		e.Transactions = append(e.Transactions, et)
+	}
+
+	return e, nil
+}
+
+// Header возвращает описание транзакции для человека, без XDR
+func (t ExportTransaction) Header() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "transaction %d/%d\n", t.Chunk+1, t.Total)
+	fmt.Fprintf(&b, "hash: %s\n", t.Hash)
+	fmt.Fprintf(&b, "source: %s\n", t.Source)
+	fmt.Fprintf(&b, "sequence: %d\n", t.Sequence)
+	if t.ValidUntil.IsZero() {
+		b.WriteString("valid until: no limit\n")
+	} else {
+		fmt.Fprintf(&b, "valid until: %s\n", t.ValidUntil.Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, "operations: %d\n", len(t.Operations))
+	for _, op := range t.Operations {
+		fmt.Fprintf(&b, "  %s\n", op)
+	}
+
+	return b.String()
+}
+
+// Write записывает выгрузку в текстовом виде. Подписанный на другой машине файл
+// читает ReadSigned: достаточно заменить строки xdr подписанными транзакциями.
+func (e Export) Write(w io.Writer) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "report: %d\n", e.ReportID)
+	fmt.Fprintf(&b, "%s%s\n", exportReportHashPrefix, e.ReportHash)
+	fmt.Fprintf(&b, "network: %s\n", e.Network)
+
+	for _, t := range e.Transactions {
+		fmt.Fprintf(&b, "\n%s%s%s\n", t.Header(), exportXDRPrefix, t.XDR)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ReadSigned читает подписанные транзакции: строки "xdr: ..." файла выгрузки или
+// просто XDR по одной в строке. Возвращает хэш отчета, если он есть в файле.
+func ReadSigned(r io.Reader) (string, []string, error) {
+	var (
+		reportHash string
+		xdrs       []string
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case strings.HasPrefix(line, exportReportHashPrefix):
+			reportHash = strings.TrimPrefix(line, exportReportHashPrefix)
+		case strings.HasPrefix(line, exportXDRPrefix):
+			xdrs = append(xdrs, strings.TrimPrefix(line, exportXDRPrefix))
+		case line != "" && !strings.Contains(line, " "):
+			if _, err := txnbuild.TransactionFromXDR(line); err == nil {
+				xdrs = append(xdrs, line)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", nil, err
+	}
+
+	return reportHash, xdrs, nil
+}
+
+func describeOperation(op txnbuild.Operation) string {
+	switch op := op.(type) {
+	case *txnbuild.Payment:
+		return fmt.Sprintf("payment %s %s -> %s", op.Amount, assetString(op.Asset), op.Destination)
+	case *txnbuild.CreateClaimableBalance:
+		destination := ""
+		if len(op.Destinations) > 0 {
+			destination = op.Destinations[0].Destination
+		}
+		return fmt.Sprintf("claimable balance %s %s -> %s", op.Amount, assetString(op.Asset), destination)
+	default:
+		return fmt.Sprintf("%T", op)
+	}
+}
+
+func assetString(asset txnbuild.Asset) string {
+	if asset.IsNative() {
+		return "XLM"
+	}
+	return asset.GetCode() + ":" + asset.GetIssuer()
+}
@@ -0,0 +1,75 @@
+package distributor_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mtlprog/mlm/db"
+	"github.com/mtlprog/mlm/distributor"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	source := keypair.MustRandom()
+	signer := keypair.MustRandom()
+	destination := keypair.MustRandom().Address()
+
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &txnbuild.SimpleAccount{AccountID: source.Address(), Sequence: 1},
+		IncrementSequenceNum: true,
+		Operations: []txnbuild.Operation{&txnbuild.Payment{
+			Destination: destination,
+			Amount:      "1.5000000",
+			Asset:       txnbuild.CreditAsset{Code: "EURMTL", Issuer: source.Address()},
+		}},
+		BaseFee:       txnbuild.MinBaseFee,
+		Preconditions: txnbuild.Preconditions{TimeBounds: txnbuild.NewTimeout(60)},
+	})
+	require.NoError(t, err)
+
+	xdr, err := tx.Base64()
+	require.NoError(t, err)
+
+	// Первая транзакция отчета уже выполнена, выгружается вторая из двух
+	txs := []db.ReportTransaction{{ReportID: 7, Chunk: 1, Xdr: xdr}}
+
+	export, err := distributor.NewExport(7, network.TestNetworkPassphrase, 2, txs)
+	require.NoError(t, err)
+	require.Len(t, export.Transactions, 1)
+	require.Contains(t, export.Transactions[0].Header(), "transaction 2/2\n")
+	require.Equal(t, distributor.ReportHash(txs), export.ReportHash)
+	require.Equal(t, int64(2), export.Transactions[0].Sequence)
+	require.Equal(t, []string{"payment 1.5000000 EURMTL:" + source.Address() + " -> " + destination}, export.Transactions[0].Operations)
+
+	var buf bytes.Buffer
+	require.NoError(t, export.Write(&buf))
+
+	t.Run("выгрузка с подписанными xdr", func(t *testing.T) {
+		signedTx, err := tx.Sign(network.TestNetworkPassphrase, signer)
+		require.NoError(t, err)
+		signed, err := signedTx.Base64()
+		require.NoError(t, err)
+
+		file := strings.Replace(buf.String(), "xdr: "+xdr, "xdr: "+signed, 1)
+
+		reportHash, xdrs, err := distributor.ReadSigned(strings.NewReader(file))
+		require.NoError(t, err)
+		require.Equal(t, export.ReportHash, reportHash)
+		require.Equal(t, []string{signed}, xdrs)
+	})
+
+	t.Run("xdr по одной в строке", func(t *testing.T) {
+		reportHash, xdrs, err := distributor.ReadSigned(strings.NewReader("\n" + xdr + "\n"))
+		require.NoError(t, err)
+		require.Empty(t, reportHash)
+		require.Equal(t, []string{xdr}, xdrs)
+	})
+
+	t.Run("хэш меняется вместе с транзакциями", func(t *testing.T) {
+		require.NotEqual(t, export.ReportHash, distributor.ReportHash(nil))
+	})
+}
@@ -0,0 +1,333 @@
+package distributor_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/config"
+	"github.com/mtlprog/mlm/db"
+	"github.com/mtlprog/mlm/distributor"
+	"github.com/mtlprog/mlm/stellar"
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/protocols/horizon"
+)
+
+// newDistributor возвращает распределитель без базы и Horizon с формулой награды по приросту MTLAP
+func newDistributor(cfg *config.Config) *distributor.Distributor {
+	return distributor.New(cfg, nil, nil, nil, distributor.DeltaRewardPolicy{})
+}
+
+// newDBDistributor возвращает распределитель с базой fakeDB и Horizon fakeStellar
+func newDBDistributor(t *testing.T, cfg *config.Config, st *fakeStellar) (*distributor.Distributor, *fakeDB) {
+	t.Helper()
+
+	fdb := newFakeDB()
+
+	return distributor.New(cfg, st, db.New(fdb), fdb, distributor.DeltaRewardPolicy{}), fdb
+}
+
+// dbConfig возвращает настройки для распределителя с базой: бюджет LABR — фиксированные 100 LABR
+func dbConfig(address string) *config.Config {
+	return &config.Config{
+		Address:             address,
+		HorizonConcurrency:  1,
+		TransactionValidity: time.Hour,
+		ConflictPolicy:      config.ConflictPolicySkip,
+		PayoutCapExcess:     config.PayoutCapExcessRedistribute,
+		RewardAssets: []config.RewardAsset{{
+			Code:         stellar.LABRAsset,
+			Issuer:       stellar.LABRIssuer,
+			BudgetPolicy: config.BudgetPolicyFixed,
+			BudgetAmount: 100 * amount.One,
+		}},
+	}
+}
+
+// recommenders возвращает рекомендателей со случайными адресами, у каждого по одному
+// рекомендуемому с приростом MTLAP 1
+func recommenders(n int) []mlm.Recommender {
+	res := make([]mlm.Recommender, n)
+	for i := range res {
+		res[i] = mlm.Recommender{
+			AccountID:   keypair.MustRandom().Address(),
+			Recommended: []mlm.Recommended{{AccountID: fmt.Sprintf("user%d", i), MTLAP: 1}},
+		}
+	}
+	return res
+}
+
+func labrBudget(amount int64, owed map[string]*big.Rat) []distributor.AssetBudget {
+	return []distributor.AssetBudget{{
+		Budget: mlm.Budget{Asset: mlm.Asset{Code: stellar.LABRAsset, Issuer: stellar.LABRIssuer}},
+		Amount: amount,
+		Owed:   owed,
+	}}
+}
+
+// fakeCall — выполненный запрос sqlc с аргументами
+type fakeCall struct {
+	Name string
+	Args []any
+	Tx   bool // выполнен в транзакции
+}
+
+// fakeDB — база данных в памяти для db.Queries. Запросы различаются по имени sqlc.
+// Ответ задается через on: срез строк, одна строка, функция от аргументов или ошибка.
+// Строка — структура, поля которой идут в порядке колонок, или одно значение.
+type fakeDB struct {
+	results   map[string]any
+	calls     []fakeCall
+	committed bool
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{results: make(map[string]any)}
+}
+
+func (f *fakeDB) on(name string, result any) {
+	f.results[name] = result
+}
+
+// called возвращает выполненные запросы с именем name
+func (f *fakeDB) called(name string) []fakeCall {
+	var res []fakeCall
+	for _, c := range f.calls {
+		if c.Name == name {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func (f *fakeDB) result(sql string, args []any, tx bool) (string, []any, error) {
+	name := queryName(sql)
+	f.calls = append(f.calls, fakeCall{Name: name, Args: args, Tx: tx})
+
+	res, ok := f.results[name]
+	if !ok {
+		return name, nil, nil
+	}
+
+	if fn, ok := res.(func(args []any) any); ok {
+		res = fn(args)
+	}
+
+	if err, ok := res.(error); ok {
+		return name, nil, err
+	}
+
+	v := reflect.ValueOf(res)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+		return name, []any{res}, nil
+	}
+
+	rows := make([]any, v.Len())
+	for i := range rows {
+		rows[i] = v.Index(i).Interface()
+	}
+
+	return name, rows, nil
+}
+
+func (f *fakeDB) exec(sql string, args []any, tx bool) (pgconn.CommandTag, error) {
+	_, rows, err := f.result(sql, args, tx)
+	return pgconn.NewCommandTag(fmt.Sprintf("UPDATE %d", len(rows))), err
+}
+
+func (f *fakeDB) query(sql string, args []any, tx bool) (pgx.Rows, error) {
+	_, rows, err := f.result(sql, args, tx)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: rows, i: -1}, nil
+}
+
+func (f *fakeDB) queryRow(sql string, args []any, tx bool) pgx.Row {
+	_, rows, err := f.result(sql, args, tx)
+	return &fakeRow{rows: rows, err: err}
+}
+
+func (f *fakeDB) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return f.exec(sql, args, false)
+}
+
+func (f *fakeDB) Query(_ context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return f.query(sql, args, false)
+}
+
+func (f *fakeDB) QueryRow(_ context.Context, sql string, args ...any) pgx.Row {
+	return f.queryRow(sql, args, false)
+}
+
+func (f *fakeDB) BeginTx(context.Context, pgx.TxOptions) (pgx.Tx, error) {
+	return &fakeTx{db: f}, nil
+}
+
+// fakeTx — транзакция fakeDB. Остальные методы pgx.Tx не нужны distributor.
+type fakeTx struct {
+	pgx.Tx
+	db *fakeDB
+}
+
+func (t *fakeTx) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return t.db.exec(sql, args, true)
+}
+
+func (t *fakeTx) Query(_ context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return t.db.query(sql, args, true)
+}
+
+func (t *fakeTx) QueryRow(_ context.Context, sql string, args ...any) pgx.Row {
+	return t.db.queryRow(sql, args, true)
+}
+
+func (t *fakeTx) Commit(context.Context) error {
+	t.db.committed = true
+	return nil
+}
+
+func (t *fakeTx) Rollback(context.Context) error {
+	return nil
+}
+
+type fakeRows struct {
+	pgx.Rows
+	rows []any
+	i    int
+}
+
+func (r *fakeRows) Next() bool {
+	r.i++
+	return r.i < len(r.rows)
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	return scanRow(r.rows[r.i], dest)
+}
+
+func (r *fakeRows) Close() {}
+
+func (r *fakeRows) Err() error {
+	return nil
+}
+
+type fakeRow struct {
+	rows []any
+	err  error
+}
+
+func (r *fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.rows) == 0 {
+		return pgx.ErrNoRows
+	}
+	return scanRow(r.rows[0], dest)
+}
+
+// scanRow раскладывает поля структуры row по dest в порядке объявления
+func scanRow(row any, dest []any) error {
+	v := reflect.ValueOf(row)
+
+	if v.Kind() != reflect.Struct || len(dest) == 1 && v.NumField() != 1 {
+		reflect.ValueOf(dest[0]).Elem().Set(v)
+		return nil
+	}
+
+	if v.NumField() != len(dest) {
+		return fmt.Errorf("scan %T: %d columns, %d destinations", row, v.NumField(), len(dest))
+	}
+
+	for i := range dest {
+		reflect.ValueOf(dest[i]).Elem().Set(v.Field(i))
+	}
+
+	return nil
+}
+
+// queryName возвращает имя запроса sqlc из комментария "-- name: Name :kind"
+func queryName(sql string) string {
+	fields := strings.Fields(strings.TrimPrefix(sql, "-- name:"))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// fakeStellar — Horizon в памяти. Счета из noTrustline не имеют линий доверия,
+// submit возвращает состояние отправки по порядку отправок.
+type fakeStellar struct {
+	balances    map[string]string // код актива — баланс программы
+	recs        func() *mlm.RecommendersFetchResult
+	noTrustline map[string]bool
+	sequence    int64
+
+	statuses  []string          // состояния отправок по порядку, по умолчанию success
+	onNetwork map[string]string // хэш — состояние транзакции в сети
+	submitted []string
+}
+
+func (s *fakeStellar) Balance(_ context.Context, _, asset, _ string) (string, error) {
+	return s.balances[asset], nil
+}
+
+func (s *fakeStellar) HasTrustline(_ context.Context, accountID, _, _ string) (bool, error) {
+	return !s.noTrustline[accountID], nil
+}
+
+func (s *fakeStellar) Recommenders(context.Context) (*mlm.RecommendersFetchResult, error) {
+	return s.recs(), nil
+}
+
+func (s *fakeStellar) AccountDetail(accountID string) (horizon.Account, error) {
+	return horizon.Account{AccountID: accountID, Sequence: s.sequence}, nil
+}
+
+func (s *fakeStellar) GetSwapPriceForAmount(_ context.Context, _, _, _, _ string, sourceAmount int64) (int64, error) {
+	return sourceAmount, nil
+}
+
+func (s *fakeStellar) SubmitXDR(_ context.Context, _, xdr string) (string, string, error) {
+	s.submitted = append(s.submitted, xdr)
+
+	status := mlm.TransactionSuccess
+	if n := len(s.submitted); n <= len(s.statuses) {
+		status = s.statuses[n-1]
+	}
+
+	hash := fmt.Sprintf("hash%d", len(s.submitted))
+
+	switch status {
+	case mlm.TransactionSuccess:
+		return hash, status, nil
+	case "":
+		return "", "", stellar.ErrNotEnoughSignatures
+	default:
+		return hash, status, errors.New("submit failed")
+	}
+}
+
+func (s *fakeStellar) TransactionStatus(_ context.Context, hash string) (string, error) {
+	if status, ok := s.onNetwork[hash]; ok {
+		return status, nil
+	}
+	return mlm.TransactionUnknown, nil
+}
+
+var (
+	_ mlm.StellarAgregator             = &fakeStellar{}
+	_ distributor.TransactionSubmitter = &fakeStellar{}
+	_ distributor.TxBeginner           = &fakeDB{}
+	_ db.DBTX                          = &fakeDB{}
+)
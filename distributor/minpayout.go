@@ -0,0 +1,50 @@
+package distributor
+
+import (
+	"math/big"
+
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/db"
+	"github.com/samber/lo"
+)
+
+// applyMinPayout переносит выплаты меньше MinPayout в долги рекомендателям. Долг копится
+// в журнале переноса и выплачивается, когда вместе с новой наградой достигает минимума.
+// Возвращает оставшиеся выплаты и перенесенную в долги сумму.
+func (d *Distributor) applyMinPayout(res *mlm.AssetDistribution, distributes []db.ReportDistribute) ([]db.ReportDistribute, int64) {
+	if d.cfg.MinPayout <= 0 {
+		return distributes, 0
+	}
+
+	res.MinPayout = d.cfg.MinPayout
+
+	pending := int64(0)
+
+	distributes = lo.Filter(distributes, func(dist db.ReportDistribute, _ int) bool {
+		if dist.Amount >= d.cfg.MinPayout {
+			return true
+		}
+
+		pending += dist.Amount
+		addOwed(res, dist.Recommender, new(big.Rat).SetInt64(dist.Amount))
+
+		return false
+	})
+
+	return distributes, pending
+}
+
+// addOwed добавляет сумму к долгу рекомендателю или создает новый долг
+func addOwed(res *mlm.AssetDistribution, accountID string, amount *big.Rat) {
+	for i, o := range res.Owed {
+		if o.AccountID == accountID {
+			res.Owed[i].Amount = new(big.Rat).Add(o.Amount, amount)
+			return
+		}
+	}
+
+	res.Owed = append(res.Owed, mlm.Owed{
+		AccountID: accountID,
+		Amount:    amount,
+	})
+}
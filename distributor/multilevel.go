@@ -0,0 +1,130 @@
+package distributor
+
+import (
+	"math/big"
+
+	"github.com/mtlprog/mlm"
+)
+
+// multilevelShares возвращает доли вышестоящих рекомендателей, начиная с уровня 2,
+// обрезанные по MultilevelMaxDepth
+func (d *Distributor) multilevelShares() []*big.Rat {
+	shares := d.cfg.MultilevelShares
+	if d.cfg.MultilevelMaxDepth > 0 && len(shares) > d.cfg.MultilevelMaxDepth-1 {
+		shares = shares[:d.cfg.MultilevelMaxDepth-1]
+	}
+
+	res := make([]*big.Rat, len(shares))
+	for i, share := range shares {
+		res[i] = new(big.Rat).Quo(ratFromFloat(share), big.NewRat(100, 1))
+	}
+
+	return res
+}
+
+// upstreamRecommenders возвращает для каждого рекомендателя того, кто рекомендовал его самого.
+// Связь учитывается, только если рекомендация засчитана одному рекомендателю:
+// поделенный конфликт обрывает цепочку. Исключенный рекомендатель остается в цепочке,
+// его пропускает upstreamChain.
+func (d *Distributor) upstreamRecommenders(recs *mlm.RecommendersFetchResult) map[string]string {
+	upstream := make(map[string]string) // recommended-recommender
+
+	for _, recommender := range recs.Recommenders {
+		for _, recommended := range recommender.Recommended {
+			if counted, sharedBy := d.conflictShare(recs, recommender.AccountID, recommended.AccountID); counted && sharedBy == 1 {
+				upstream[recommended.AccountID] = recommender.AccountID
+			}
+		}
+	}
+
+	return upstream
+}
+
+// upstreamChain возвращает вышестоящих рекомендателей accountID, начиная с уровня 2,
+// не длиннее depth. Исключенные рекомендатели пропускаются: их уровень получает
+// следующий вышестоящий. Цепочка обрывается на первом повторе счета, поэтому циклы
+// рекомендаций не начисляют награду по кругу.
+func upstreamChain(recs *mlm.RecommendersFetchResult, upstream map[string]string, accountID string, depth int) []string {
+	visited := map[string]struct{}{accountID: {}}
+	chain := make([]string, 0, depth)
+
+	for len(chain) < depth {
+		next, ok := upstream[accountID]
+		if !ok {
+			break
+		}
+		if _, ok := visited[next]; ok {
+			break
+		}
+
+		visited[next] = struct{}{}
+		accountID = next
+
+		if isExcluded(recs, next) {
+			continue
+		}
+
+		chain = append(chain, next)
+	}
+
+	return chain
+}
+
+// applyMultilevel передает вышестоящим рекомендателям долю награды каждого рекомендателя:
+// на уровне L — MultilevelShares[L-2] от его собственных долей. Переданное вычитается
+// из долей рекомендателя, поэтому сумма долей не меняется. Возвращает дельты MTLAP
+// с разбивкой по уровням для отчета.
+func (d *Distributor) applyMultilevel(
+	recs *mlm.RecommendersFetchResult,
+	parts []*big.Rat,
+	deltas []mlm.RecommendDelta,
+) []mlm.RecommendDelta {
+	shares := d.multilevelShares()
+	if len(shares) == 0 {
+		return nil
+	}
+
+	upstream := d.upstreamRecommenders(recs)
+
+	index := make(map[string]int, len(recs.Recommenders))
+	for i, recommender := range recs.Recommenders {
+		index[recommender.AccountID] = i
+	}
+
+	base := make([]*big.Rat, len(parts))
+	for i, p := range parts {
+		base[i] = new(big.Rat).Set(p)
+	}
+
+	deltasByRecommender := make(map[string][]mlm.RecommendDelta)
+	for _, delta := range deltas {
+		deltasByRecommender[delta.Recommender] = append(deltasByRecommender[delta.Recommender], delta)
+	}
+
+	var res []mlm.RecommendDelta
+
+	for i, recommender := range recs.Recommenders {
+		if base[i].Sign() <= 0 {
+			continue
+		}
+
+		for level, accountID := range upstreamChain(recs, upstream, recommender.AccountID, len(shares)) {
+			share := new(big.Rat).Mul(base[i], shares[level])
+
+			parts[i].Sub(parts[i], share)
+			parts[index[accountID]].Add(parts[index[accountID]], share)
+
+			for _, delta := range deltasByRecommender[recommender.AccountID] {
+				res = append(res, mlm.RecommendDelta{
+					Recommender: accountID,
+					Recommended: delta.Recommended,
+					Delta:       delta.Delta,
+					Level:       level + 2,
+					Via:         recommender.AccountID,
+				})
+			}
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,120 @@
+package distributor
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/config"
+)
+
+const (
+	RewardPolicyDelta          = "delta"
+	RewardPolicyTiered         = "tiered"
+	RewardPolicyNewMemberBonus = "new_member_bonus"
+	RewardPolicyDiminishing    = "diminishing"
+)
+
+// DeltaRewardPolicy — одна доля за каждый новый MTLAP рекомендуемого
+type DeltaRewardPolicy struct{}
+
+func (DeltaRewardPolicy) Name() string { return RewardPolicyDelta }
+
+func (DeltaRewardPolicy) Parts(changes []mlm.RewardChange) float64 {
+	return float64(sumDelta(changes))
+}
+
+// TieredRewardPolicy — вес каждого нового MTLAP зависит от достигнутого уровня.
+// Weights[i] — вес уровня i+1, уровни выше последнего используют последний вес.
+type TieredRewardPolicy struct {
+	Weights []float64
+}
+
+func (p TieredRewardPolicy) Name() string { return RewardPolicyTiered }
+
+func (p TieredRewardPolicy) Parts(changes []mlm.RewardChange) float64 {
+	if len(p.Weights) == 0 {
+		return 0
+	}
+
+	parts := 0.0
+
+	for _, c := range changes {
+		for level := c.LastMTLAP + 1; level <= c.MTLAP; level++ {
+			parts += p.Weights[min(int(level)-1, len(p.Weights)-1)]
+		}
+	}
+
+	return parts
+}
+
+// NewMemberBonusRewardPolicy — как DeltaRewardPolicy, плюс фиксированный бонус за каждого нового участника
+type NewMemberBonusRewardPolicy struct {
+	Bonus float64
+}
+
+func (p NewMemberBonusRewardPolicy) Name() string { return RewardPolicyNewMemberBonus }
+
+func (p NewMemberBonusRewardPolicy) Parts(changes []mlm.RewardChange) float64 {
+	parts := float64(sumDelta(changes))
+
+	for _, c := range changes {
+		if c.New && c.MTLAP > 0 {
+			parts += p.Bonus
+		}
+	}
+
+	return parts
+}
+
+// DiminishingRewardPolicy — доли растут как квадратный корень от суммы новых MTLAP рекомендателя
+type DiminishingRewardPolicy struct{}
+
+func (DiminishingRewardPolicy) Name() string { return RewardPolicyDiminishing }
+
+func (DiminishingRewardPolicy) Parts(changes []mlm.RewardChange) float64 {
+	return math.Sqrt(float64(sumDelta(changes)))
+}
+
+// NewRewardPolicy возвращает формулу награды, выбранную в конфигурации
+func NewRewardPolicy(cfg *config.Config) (mlm.RewardPolicy, error) {
+	switch cfg.RewardPolicy {
+	case "", RewardPolicyDelta:
+		return DeltaRewardPolicy{}, nil
+	case RewardPolicyTiered:
+		if len(cfg.RewardTierWeights) == 0 {
+			return nil, fmt.Errorf("REWARD_TIER_WEIGHTS is required for %s reward policy", RewardPolicyTiered)
+		}
+		return TieredRewardPolicy{Weights: cfg.RewardTierWeights}, nil
+	case RewardPolicyNewMemberBonus:
+		return NewMemberBonusRewardPolicy{Bonus: cfg.RewardNewMemberBonus}, nil
+	case RewardPolicyDiminishing:
+		return DiminishingRewardPolicy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown reward policy: %s", cfg.RewardPolicy)
+	}
+}
+
+// policyParts возвращает доли по формуле награды точной дробью, отрицательные доли считаются нулем.
+// Бесконечность и NaN не переводятся в дробь, для них возвращается ErrInvalidParts.
+func (d *Distributor) policyParts(changes []mlm.RewardChange) (*big.Rat, error) {
+	parts := d.policy.Parts(changes)
+	if math.IsNaN(parts) || math.IsInf(parts, 0) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidParts, d.policy.Name())
+	}
+
+	return new(big.Rat).SetFloat64(max(parts, 0)), nil
+}
+
+func sumDelta(changes []mlm.RewardChange) int64 {
+	total := int64(0)
+
+	for _, c := range changes {
+		if c.LastMTLAP < c.MTLAP {
+			total += c.MTLAP - c.LastMTLAP
+		}
+	}
+
+	return total
+}
@@ -0,0 +1,80 @@
+package distributor_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/config"
+	"github.com/mtlprog/mlm/distributor"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewardPolicies(t *testing.T) {
+	changes := []mlm.RewardChange{
+		{Recommender: "rec1", Recommended: "user1", LastMTLAP: 0, MTLAP: 3, New: true},
+		{Recommender: "rec1", Recommended: "user2", LastMTLAP: 2, MTLAP: 3},
+		{Recommender: "rec1", Recommended: "user3", LastMTLAP: 5, MTLAP: 4}, // понижение не учитывается
+	}
+
+	tests := []struct {
+		name   string
+		policy mlm.RewardPolicy
+		want   float64
+	}{
+		{
+			name:   "delta",
+			policy: distributor.DeltaRewardPolicy{},
+			want:   4, // 3 + 1
+		},
+		{
+			name:   "tiered",
+			policy: distributor.TieredRewardPolicy{Weights: []float64{1, 2}},
+			want:   7, // user1: 1 + 2 + 2, user2: 2
+		},
+		{
+			name:   "new_member_bonus",
+			policy: distributor.NewMemberBonusRewardPolicy{Bonus: 5},
+			want:   9, // 4 + 5 за user1
+		},
+		{
+			name:   "diminishing",
+			policy: distributor.DiminishingRewardPolicy{},
+			want:   2, // sqrt(4)
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.InDelta(t, tt.want, tt.policy.Parts(changes), 0.0001)
+		})
+	}
+}
+
+func TestNewRewardPolicy(t *testing.T) {
+	p, err := distributor.NewRewardPolicy(&config.Config{})
+	require.NoError(t, err)
+	require.Equal(t, distributor.RewardPolicyDelta, p.Name())
+
+	_, err = distributor.NewRewardPolicy(&config.Config{RewardPolicy: distributor.RewardPolicyTiered})
+	require.Error(t, err)
+
+	_, err = distributor.NewRewardPolicy(&config.Config{RewardPolicy: "unknown"})
+	require.Error(t, err)
+}
+
+func TestCalculatePartsNonFinitePolicy(t *testing.T) {
+	recs := &mlm.RecommendersFetchResult{
+		Recommenders: []mlm.Recommender{
+			{AccountID: "rec1", Recommended: []mlm.Recommended{{AccountID: "user1", MTLAP: 1}}},
+		},
+		Conflict: map[string][]string{},
+	}
+
+	for _, weight := range []float64{math.Inf(1), math.NaN()} {
+		d := distributor.New(&config.Config{}, nil, nil, nil, distributor.TieredRewardPolicy{Weights: []float64{weight}})
+
+		_, err := d.CalculateParts(map[string]int64{}, labrBudget(100, nil), recs)
+		require.ErrorIs(t, err, distributor.ErrInvalidParts)
+	}
+}
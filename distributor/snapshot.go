@@ -0,0 +1,37 @@
+package distributor
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/db"
+)
+
+func (d *Distributor) createSnapshot(ctx context.Context, q *db.Queries, reportID int64, snapshot *mlm.Snapshot) error {
+	if snapshot == nil {
+		return nil
+	}
+
+	accounts, err := json.Marshal(snapshot.Accounts)
+	if err != nil {
+		return err
+	}
+
+	return q.CreateReportSnapshot(ctx, db.CreateReportSnapshotParams{
+		ReportID: reportID,
+		Ledger:   snapshot.Ledger,
+		Accounts: accounts,
+	})
+}
+
+// SnapshotFromRow разбирает сохраненный с отчетом снимок Horizon
+func SnapshotFromRow(row db.ReportSnapshot) (*mlm.Snapshot, error) {
+	snapshot := &mlm.Snapshot{Ledger: row.Ledger}
+
+	if err := json.Unmarshal(row.Accounts, &snapshot.Accounts); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
@@ -0,0 +1,225 @@
+package distributor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/config"
+	"github.com/mtlprog/mlm/db"
+	"github.com/mtlprog/mlm/stellar"
+	"github.com/samber/lo"
+)
+
+// TransactionSubmitter отправляет транзакции и проверяет их состояние в сети
+type TransactionSubmitter interface {
+	SubmitXDR(ctx context.Context, seed, xdr string) (string, string, error)
+	TransactionStatus(ctx context.Context, hash string) (string, error)
+}
+
+// Submitter отправляет транзакции сохраненных отчетов
+type Submitter struct {
+	cfg     *config.Config
+	q       *db.Queries
+	distrib *Distributor
+	stellar TransactionSubmitter
+	log     *slog.Logger
+}
+
+// Submit отправляет транзакции отчета по порядку, пропуская выполненные.
+// Сначала сверяет с сетью транзакции с неизвестным результатом. Если транзакция отклонена
+// или истекла, а остальные уже не могут попасть в сеть, невыполненные транзакции
+// пересобираются с новым sequence number и сроком действия.
+// При ошибке оставшиеся транзакции будут отправлены при следующем запуске.
+func (s *Submitter) Submit(ctx context.Context, reportID int64) error {
+	txs, err := s.q.GetReportTransactions(ctx, reportID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.reconcile(ctx, txs); err != nil {
+		return err
+	}
+
+	if err := s.rebuild(ctx, txs); err != nil {
+		return err
+	}
+
+	for _, t := range txs {
+		if t.Status == mlm.TransactionSuccess {
+			s.log.InfoContext(ctx, "transaction already submitted",
+				slog.Int64("report_id", reportID),
+				slog.Int("chunk", int(t.Chunk)),
+				slog.String("hash", t.Hash.String),
+			)
+			continue
+		}
+
+		hash, status, err := s.stellar.SubmitXDR(ctx, s.cfg.Seed, SignedEnvelope(t))
+		if errors.Is(err, stellar.ErrNotEnoughSignatures) {
+			return fmt.Errorf("transaction %d/%d of report %d: %w, add signatures with mlmc report sign %d",
+				t.Chunk+1, len(txs), reportID, err, reportID)
+		}
+		if status != "" {
+			if err := s.setStatus(ctx, t, hash, status); err != nil {
+				return err
+			}
+		}
+		if status == mlm.TransactionUnknown {
+			return fmt.Errorf("transaction %d/%d of report %d: result unknown, run again to reconcile: %w",
+				t.Chunk+1, len(txs), reportID, err)
+		}
+		if err != nil {
+			return fmt.Errorf("submit transaction %d/%d of report %d: %w", t.Chunk+1, len(txs), reportID, err)
+		}
+
+		s.log.InfoContext(ctx, "transaction submitted",
+			slog.Int64("report_id", reportID),
+			slog.Int("chunk", int(t.Chunk)),
+			slog.String("hash", hash),
+		)
+	}
+
+	return nil
+}
+
+// reconcile проверяет по хэшу транзакции с неизвестным результатом.
+// Не найденная в сети транзакция считается отклоненной, только когда истек ее срок.
+func (s *Submitter) reconcile(ctx context.Context, txs []db.ReportTransaction) error {
+	for i, t := range txs {
+		if t.Status != mlm.TransactionUnknown {
+			continue
+		}
+
+		status, err := s.stellar.TransactionStatus(ctx, t.Hash.String)
+		if err != nil {
+			return fmt.Errorf("check transaction %s: %w", t.Hash.String, err)
+		}
+
+		if status == mlm.TransactionUnknown {
+			expired, err := stellar.TransactionExpired(t.Xdr, time.Now())
+			if err != nil {
+				return err
+			}
+			if !expired {
+				continue
+			}
+			status = mlm.TransactionFailed
+		}
+
+		if err := s.setStatus(ctx, t, t.Hash.String, status); err != nil {
+			return err
+		}
+
+		txs[i].Status = status
+
+		s.log.InfoContext(ctx, "transaction reconciled",
+			slog.Int64("report_id", t.ReportID),
+			slog.Int("chunk", int(t.Chunk)),
+			slog.String("hash", t.Hash.String),
+			slog.String("status", status),
+		)
+	}
+
+	return nil
+}
+
+// rebuild пересобирает невыполненные транзакции, если среди них есть отклоненная
+// или истекшая. Пока результат какой-то транзакции неизвестен, пересобирать нельзя:
+// она еще может выполниться, и выплата повторится.
+func (s *Submitter) rebuild(ctx context.Context, txs []db.ReportTransaction) error {
+	var (
+		rebuild bool
+		pending []int
+	)
+
+	for i, t := range txs {
+		switch t.Status {
+		case mlm.TransactionSuccess:
+			continue
+		case mlm.TransactionUnknown:
+			return nil
+		case mlm.TransactionFailed:
+			rebuild = true
+		default:
+			expired, err := stellar.TransactionExpired(t.Xdr, time.Now())
+			if err != nil {
+				return err
+			}
+			rebuild = rebuild || expired
+		}
+
+		pending = append(pending, i)
+	}
+
+	if !rebuild {
+		return nil
+	}
+
+	xdrs, err := s.distrib.RebuildXDRs(ctx, lo.Map(pending, func(i int, _ int) string { return txs[i].Xdr }))
+	if err != nil {
+		return err
+	}
+
+	for j, i := range pending {
+		if err := s.q.UpdateReportTransactionXDR(ctx, db.UpdateReportTransactionXDRParams{
+			Xdr:      xdrs[j],
+			ReportID: txs[i].ReportID,
+			Chunk:    txs[i].Chunk,
+		}); err != nil {
+			return err
+		}
+
+		txs[i].Xdr = xdrs[j]
+		txs[i].SignedXdr = pgtype.Text{}
+		txs[i].Hash = pgtype.Text{}
+		txs[i].Status = mlm.TransactionPending
+	}
+
+	s.log.InfoContext(ctx, "transactions rebuilt", slog.Int("count", len(pending)))
+
+	if s.cfg.Seed == "" {
+		s.log.WarnContext(ctx, "rebuilt transactions need new signatures",
+			slog.Int64("report_id", txs[pending[0]].ReportID),
+		)
+	}
+
+	return nil
+}
+
+func (s *Submitter) setStatus(ctx context.Context, t db.ReportTransaction, hash, status string) error {
+	return s.q.SetReportTransactionStatus(ctx, db.SetReportTransactionStatusParams{
+		Hash:     pgtype.Text{String: hash, Valid: hash != ""},
+		Status:   status,
+		ReportID: t.ReportID,
+		Chunk:    t.Chunk,
+	})
+}
+
+// SignedEnvelope возвращает транзакцию с собранными подписями или без подписей, если их нет
+func SignedEnvelope(t db.ReportTransaction) string {
+	if t.SignedXdr.Valid {
+		return t.SignedXdr.String
+	}
+	return t.Xdr
+}
+
+func NewSubmitter(
+	cfg *config.Config,
+	q *db.Queries,
+	distrib *Distributor,
+	stellar TransactionSubmitter,
+	log *slog.Logger,
+) *Submitter {
+	return &Submitter{
+		cfg:     cfg,
+		q:       q,
+		distrib: distrib,
+		stellar: stellar,
+		log:     log,
+	}
+}
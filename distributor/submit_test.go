@@ -0,0 +1,176 @@
+package distributor_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/db"
+	"github.com/mtlprog/mlm/distributor"
+	"github.com/mtlprog/mlm/stellar"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmitter(t *testing.T) {
+	source := keypair.MustRandom().Address()
+	destination := keypair.MustRandom().Address()
+	log := slog.New(slog.DiscardHandler)
+
+	buildXDR := func(t *testing.T, sequence int64, maxTime time.Time) string {
+		t.Helper()
+
+		tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+			SourceAccount:        &txnbuild.SimpleAccount{AccountID: source, Sequence: sequence},
+			IncrementSequenceNum: true,
+			Operations: []txnbuild.Operation{&txnbuild.Payment{
+				Destination: destination,
+				Amount:      "1",
+				Asset:       txnbuild.CreditAsset{Code: stellar.LABRAsset, Issuer: stellar.LABRIssuer},
+			}},
+			BaseFee:       1000,
+			Memo:          txnbuild.MemoText("mlta mlm"),
+			Preconditions: txnbuild.Preconditions{TimeBounds: txnbuild.NewTimebounds(0, maxTime.Unix())},
+		})
+		require.NoError(t, err)
+
+		x, err := tx.Base64()
+		require.NoError(t, err)
+
+		return x
+	}
+
+	valid := time.Now().Add(time.Hour)
+	expired := time.Now().Add(-time.Hour)
+
+	newSubmitter := func(t *testing.T, st *fakeStellar, txs []db.ReportTransaction) (*distributor.Submitter, *fakeDB) {
+		t.Helper()
+
+		cfg := dbConfig(source)
+		d, fdb := newDBDistributor(t, cfg, st)
+		fdb.on("GetReportTransactions", txs)
+
+		return distributor.NewSubmitter(cfg, db.New(fdb), d, st, log), fdb
+	}
+
+	statuses := func(fdb *fakeDB) map[int32]string {
+		res := make(map[int32]string)
+		for _, c := range fdb.called("SetReportTransactionStatus") {
+			res[c.Args[3].(int32)] = c.Args[1].(string)
+		}
+		return res
+	}
+
+	t.Run("отправляет невыполненные по порядку", func(t *testing.T) {
+		st := &fakeStellar{}
+		s, fdb := newSubmitter(t, st, []db.ReportTransaction{
+			{ReportID: 1, Chunk: 0, Xdr: buildXDR(t, 1, valid), Status: mlm.TransactionSuccess, Hash: pgtype.Text{String: "done", Valid: true}},
+			{ReportID: 1, Chunk: 1, Xdr: buildXDR(t, 2, valid), Status: mlm.TransactionPending},
+			{ReportID: 1, Chunk: 2, Xdr: buildXDR(t, 3, valid), Status: mlm.TransactionPending, SignedXdr: pgtype.Text{String: "signed", Valid: true}},
+		})
+
+		require.NoError(t, s.Submit(context.Background(), 1))
+
+		require.Len(t, st.submitted, 2)
+		require.Equal(t, "signed", st.submitted[1], "отправляется транзакция с собранными подписями")
+		require.Equal(t, map[int32]string{1: mlm.TransactionSuccess, 2: mlm.TransactionSuccess}, statuses(fdb))
+		require.Empty(t, fdb.called("UpdateReportTransactionXDR"))
+	})
+
+	t.Run("останавливается на неизвестном результате", func(t *testing.T) {
+		st := &fakeStellar{statuses: []string{mlm.TransactionUnknown}}
+		s, fdb := newSubmitter(t, st, []db.ReportTransaction{
+			{ReportID: 1, Chunk: 0, Xdr: buildXDR(t, 1, valid), Status: mlm.TransactionPending},
+			{ReportID: 1, Chunk: 1, Xdr: buildXDR(t, 2, valid), Status: mlm.TransactionPending},
+		})
+
+		require.ErrorContains(t, s.Submit(context.Background(), 1), "result unknown")
+
+		require.Len(t, st.submitted, 1)
+		require.Equal(t, map[int32]string{0: mlm.TransactionUnknown}, statuses(fdb))
+	})
+
+	t.Run("сверяет неизвестный результат с сетью", func(t *testing.T) {
+		st := &fakeStellar{onNetwork: map[string]string{"lost": mlm.TransactionSuccess}}
+		s, fdb := newSubmitter(t, st, []db.ReportTransaction{
+			{ReportID: 1, Chunk: 0, Xdr: buildXDR(t, 1, valid), Status: mlm.TransactionUnknown, Hash: pgtype.Text{String: "lost", Valid: true}},
+			{ReportID: 1, Chunk: 1, Xdr: buildXDR(t, 2, valid), Status: mlm.TransactionPending},
+		})
+
+		require.NoError(t, s.Submit(context.Background(), 1))
+
+		require.Len(t, st.submitted, 1, "выполненная транзакция не отправляется повторно")
+		require.Equal(t, map[int32]string{0: mlm.TransactionSuccess, 1: mlm.TransactionSuccess}, statuses(fdb))
+	})
+
+	t.Run("не пересобирает, пока результат неизвестен", func(t *testing.T) {
+		st := &fakeStellar{}
+		s, fdb := newSubmitter(t, st, []db.ReportTransaction{
+			{ReportID: 1, Chunk: 0, Xdr: buildXDR(t, 1, valid), Status: mlm.TransactionUnknown, Hash: pgtype.Text{String: "lost", Valid: true}},
+			{ReportID: 1, Chunk: 1, Xdr: buildXDR(t, 2, expired), Status: mlm.TransactionPending},
+		})
+
+		_ = s.Submit(context.Background(), 1)
+
+		require.Empty(t, fdb.called("UpdateReportTransactionXDR"))
+	})
+
+	t.Run("пересобирает после отклонения", func(t *testing.T) {
+		st := &fakeStellar{sequence: 41}
+		failed := buildXDR(t, 1, valid)
+		next := buildXDR(t, 2, valid)
+
+		s, fdb := newSubmitter(t, st, []db.ReportTransaction{
+			{ReportID: 1, Chunk: 0, Xdr: buildXDR(t, 0, valid), Status: mlm.TransactionSuccess},
+			{ReportID: 1, Chunk: 1, Xdr: failed, Status: mlm.TransactionFailed, Hash: pgtype.Text{String: "failed", Valid: true}},
+			{ReportID: 1, Chunk: 2, Xdr: next, Status: mlm.TransactionPending, SignedXdr: pgtype.Text{String: "signed", Valid: true}},
+		})
+
+		require.NoError(t, s.Submit(context.Background(), 1))
+
+		updates := fdb.called("UpdateReportTransactionXDR")
+		require.Len(t, updates, 2)
+		require.Equal(t, int32(1), updates[0].Args[2])
+		require.Equal(t, int32(2), updates[1].Args[2])
+
+		require.Len(t, st.submitted, 2)
+		require.Equal(t, updates[0].Args[0], st.submitted[0])
+		require.Equal(t, updates[1].Args[0], st.submitted[1], "старые подписи не отправляются")
+
+		for i, x := range st.submitted {
+			gtx, err := txnbuild.TransactionFromXDR(x)
+			require.NoError(t, err)
+			tx, _ := gtx.Transaction()
+			require.Equal(t, int64(42+i), tx.SequenceNumber(), "sequence number идут подряд от текущего")
+		}
+	})
+
+	t.Run("пересобирает истекшие", func(t *testing.T) {
+		st := &fakeStellar{sequence: 10}
+		s, fdb := newSubmitter(t, st, []db.ReportTransaction{
+			{ReportID: 1, Chunk: 0, Xdr: buildXDR(t, 1, expired), Status: mlm.TransactionPending},
+		})
+
+		require.NoError(t, s.Submit(context.Background(), 1))
+
+		require.Len(t, fdb.called("UpdateReportTransactionXDR"), 1)
+		expiredNow, err := stellar.TransactionExpired(st.submitted[0], time.Now())
+		require.NoError(t, err)
+		require.False(t, expiredNow)
+	})
+
+	t.Run("не хватает подписей", func(t *testing.T) {
+		st := &fakeStellar{statuses: []string{""}}
+		s, fdb := newSubmitter(t, st, []db.ReportTransaction{
+			{ReportID: 1, Chunk: 0, Xdr: buildXDR(t, 1, valid), Status: mlm.TransactionPending},
+		})
+
+		err := s.Submit(context.Background(), 1)
+		require.ErrorIs(t, err, stellar.ErrNotEnoughSignatures)
+		require.Empty(t, fdb.called("SetReportTransactionStatus"))
+	})
+}
@@ -0,0 +1,506 @@
+package distributor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/db"
+	"github.com/mtlprog/mlm/stellar"
+	"github.com/samber/lo"
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+)
+
+var ErrNoSnapshot = errors.New("report has no snapshot")
+
+// Виды расхождений при проверке отчета
+const (
+	MismatchRecommend   = "recommend"
+	MismatchDistribute  = "distribute"
+	MismatchConflict    = "conflict"
+	MismatchTransaction = "transaction"
+)
+
+// Mismatch — расхождение пересчитанного отчета с сохраненным.
+// Пустое Expected означает лишнюю запись, пустое Actual — отсутствующую.
+type Mismatch struct {
+	Kind     string
+	Key      string
+	Expected string
+	Actual   string
+}
+
+// Verification — результат проверки отчета
+type Verification struct {
+	ReportID   int64
+	Mismatches []Mismatch
+}
+
+func (v *Verification) OK() bool {
+	return len(v.Mismatches) == 0
+}
+
+// Verify пересчитывает отчет из сохраненных входных данных — снимка Horizon, рекордов MTLAP,
+// снимков срока удержания, исключений, бюджета, переноса и долгов последнего выплаченного
+// до него отчета —
+// и сравнивает результат с сохраненными рекомендациями, выплатами и конфликтами. Операции
+// сохраненных транзакций сверяются с выплатами отчета. Конфликты заново разрешаются
+// по политике конфликтов: earliest — по отчетам до проверяемого, manual — по текущим
+// решениям. Лимит выплаты, формула награды, срок удержания, срок claimable balance,
+// политики конфликтов и графа рекомендаций берутся из текущей конфигурации, поэтому
+// их изменение после создания отчета тоже покажется расхождением.
+func (d *Distributor) Verify(ctx context.Context, reportID int64) (*Verification, error) {
+	rep, err := d.q.GetReport(ctx, reportID)
+	if err != nil {
+		return nil, fmt.Errorf("get report %d: %w", reportID, err)
+	}
+
+	snapshotRow, err := d.q.GetReportSnapshot(ctx, reportID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("report %d: %w", reportID, ErrNoSnapshot)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := SnapshotFromRow(snapshotRow)
+	if err != nil {
+		return nil, fmt.Errorf("decode snapshot of report %d: %w", reportID, err)
+	}
+
+	highWater, err := d.getHighWaterMarks(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		prevCarryover []db.Carryover
+		prevArrears   []db.Arrear
+	)
+
+	prevID, err := d.lastPaidReport(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	if prevID != 0 {
+		if prevCarryover, err = d.q.GetCarryover(ctx, prevID); err != nil {
+			return nil, err
+		}
+		if prevArrears, err = d.q.GetArrears(ctx, prevID); err != nil {
+			return nil, err
+		}
+	}
+
+	stored, err := BudgetsFromJSON(rep.Budget)
+	if err != nil {
+		return nil, fmt.Errorf("decode budget of report %d: %w", reportID, err)
+	}
+
+	carry := lo.SliceToMap(CarryoverFromRows(prevCarryover), func(a mlm.AssetDistribution) (mlm.Asset, mlm.AssetDistribution) {
+		return a.Asset, a
+	})
+
+	budgets := make([]AssetBudget, 0, len(stored))
+	for _, budget := range stored {
+		b, err := newAssetBudget(budget, carry[budget.Asset])
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, b)
+	}
+
+	recommends, err := d.q.GetReportRecommends(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	distributes, err := d.q.GetReportDistributes(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts, err := d.q.GetReportConflicts(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	arrears, err := d.q.GetArrears(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	exclusions, err := d.q.GetReportExclusions(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	txs, err := d.q.GetReportTransactions(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	recs := stellar.RecommendersFromSnapshot(snapshot)
+	stellar.ValidateGraph(recs, d.cfg.GraphPolicy)
+	recs.Excluded = lo.SliceToMap(exclusions, func(e db.ReportExclusion) (string, string) {
+		return e.AccountID, e.Reason
+	})
+
+	if err := d.resolveConflicts(ctx, reportID, recs); err != nil {
+		return nil, err
+	}
+
+	if _, err := d.vest(ctx, reportID, rep.CreatedAt.Time, recs, highWater); err != nil {
+		return nil, err
+	}
+
+	res, err := d.CalculateParts(highWater, budgets, recs)
+	if err != nil {
+		return nil, fmt.Errorf("replay report %d: %w", reportID, err)
+	}
+
+	expected := d.replayArrears(res.Distributes, ArrearsFromRows(prevArrears), ArrearsFromRows(arrears), rep.CreatedAt.Time)
+
+	v := &Verification{ReportID: reportID}
+
+	v.Mismatches = append(v.Mismatches, diff(MismatchRecommend,
+		recommendValues(res.Recommends), recommendValues(recommends))...)
+	v.Mismatches = append(v.Mismatches, diff(MismatchDistribute,
+		distributeValues(expected), distributeValues(distributes))...)
+	v.Mismatches = append(v.Mismatches, diff(MismatchConflict,
+		conflictValues(res.Conflicts), conflictValues(conflicts))...)
+
+	txMismatches, err := d.CompareTransactions(txs, rep.CreatedAt.Time.Local(), distributes)
+	if err != nil {
+		return nil, err
+	}
+	v.Mismatches = append(v.Mismatches, txMismatches...)
+
+	return v, nil
+}
+
+// replayArrears повторяет applyArrears по сохраненным долгам: новые долги отчета убираются
+// из выплат, а выплаченная часть прошлых долгов — все, чего больше нет или что уменьшилось
+// из-за лимита выплаты, кроме списанных по сроку, — добавляется
+func (d *Distributor) replayArrears(distributes []db.ReportDistribute, prev, current []mlm.Arrear, createdAt time.Time) []db.ReportDistribute {
+	type arrearKey struct {
+		trustline
+		createdAt int64
+	}
+
+	key := func(a mlm.Arrear) arrearKey {
+		return arrearKey{trustline{a.AccountID, a.Asset}, a.CreatedAt.UnixMicro()}
+	}
+
+	prevAmounts := make(map[arrearKey]int64)
+	for _, a := range prev {
+		prevAmounts[key(a)] += a.Amount
+	}
+
+	currentAmounts := make(map[arrearKey]int64)
+	for _, a := range current {
+		currentAmounts[key(a)] += a.Amount
+	}
+
+	res := &mlm.DistributeResult{Distributes: slices.Clone(distributes)}
+
+	for _, a := range current {
+		if _, ok := prevAmounts[key(a)]; ok {
+			continue
+		}
+		addDistribute(res, a.AccountID, a.Asset, -a.Amount)
+	}
+
+	for _, a := range prev {
+		k := key(a)
+		rest, ok := currentAmounts[k]
+		if !ok && d.cfg.ArrearsExpiry > 0 && a.CreatedAt.Add(d.cfg.ArrearsExpiry).Before(createdAt) {
+			continue
+		}
+
+		if paid := prevAmounts[k] - rest; paid > 0 {
+			addDistribute(res, a.AccountID, a.Asset, paid)
+		}
+		delete(prevAmounts, k)
+	}
+
+	return lo.Filter(res.Distributes, func(dist db.ReportDistribute, _ int) bool { return dist.Amount != 0 })
+}
+
+// CompareTransactions разбирает XDR транзакций отчета и сверяет их с тем, что собрал бы getXDRs:
+// каждой выплате должна соответствовать ровно одна операция Payment или, для claimable
+// выплат, CreateClaimableBalance на ту же сумму с теми же получателями и условиями получения.
+// Источником транзакций должен быть счет программы, комиссия и memo с датой отчета createdAt
+// должны совпадать со сборкой. Срок действия транзакции ограничен TransactionValidity.
+// Sequence number идут подряд; разрыв допустим только после выполненной транзакции,
+// с которой начинаются пересобранные. Транзакция с собранными подписями должна иметь
+// тот же хэш, что и сохраненная, — иначе в сеть уйдет не то, что проверено.
+func (d *Distributor) CompareTransactions(txs []db.ReportTransaction, createdAt time.Time, distributes []db.ReportDistribute) ([]Mismatch, error) {
+	var mismatches []Mismatch
+
+	ops := make(map[string]string)
+
+	var prevSequence int64
+
+	for i, t := range txs {
+		gtx, err := txnbuild.TransactionFromXDR(t.Xdr)
+		if err != nil {
+			return nil, fmt.Errorf("decode transaction %d: %w", i, err)
+		}
+
+		tx, ok := gtx.Transaction()
+		if !ok {
+			mismatches = append(mismatches, Mismatch{Kind: MismatchTransaction, Key: strconv.Itoa(i), Expected: "transaction", Actual: "fee bump transaction"})
+			continue
+		}
+
+		if txSource := tx.SourceAccount().AccountID; txSource != d.cfg.Address {
+			mismatches = append(mismatches, Mismatch{Kind: MismatchTransaction, Key: strconv.Itoa(i) + " source", Expected: d.cfg.Address, Actual: txSource})
+		}
+
+		sequence := tx.SequenceNumber()
+		if i > 0 && sequence != prevSequence+1 && (sequence <= prevSequence || txs[i-1].Status != mlm.TransactionSuccess) {
+			mismatches = append(mismatches, Mismatch{Kind: MismatchTransaction, Key: strconv.Itoa(i) + " sequence",
+				Expected: strconv.FormatInt(prevSequence+1, 10), Actual: strconv.FormatInt(sequence, 10)})
+		}
+		prevSequence = sequence
+
+		if m := d.compareTimeBounds(i, tx.Timebounds()); m != nil {
+			mismatches = append(mismatches, *m)
+		}
+
+		if fee := tx.BaseFee(); fee != stellar.TransactionBaseFee {
+			mismatches = append(mismatches, Mismatch{Kind: MismatchTransaction, Key: strconv.Itoa(i) + " fee",
+				Expected: strconv.Itoa(stellar.TransactionBaseFee), Actual: strconv.FormatInt(fee, 10)})
+		}
+
+		if memo, want := memoValue(tx.Memo()), string(transactionMemo(createdAt, i, len(txs))); memo != want {
+			mismatches = append(mismatches, Mismatch{Kind: MismatchTransaction, Key: strconv.Itoa(i) + " memo", Expected: want, Actual: memo})
+		}
+
+		if t.SignedXdr.Valid {
+			m, err := d.compareSigned(i, tx, t.SignedXdr.String)
+			if err != nil {
+				return nil, err
+			}
+			if m != nil {
+				mismatches = append(mismatches, *m)
+			}
+		}
+
+		for j, op := range tx.Operations() {
+			var (
+				destination, amt string
+				asset            txnbuild.Asset
+				claimants        []txnbuild.Claimant
+			)
+
+			switch op := op.(type) {
+			case *txnbuild.Payment:
+				destination, amt, asset = op.Destination, op.Amount, op.Asset
+			case *txnbuild.CreateClaimableBalance:
+				if len(op.Destinations) > 0 {
+					destination = op.Destinations[0].Destination
+				}
+				amt, asset, claimants = op.Amount, op.Asset, op.Destinations
+			default:
+				mismatches = append(mismatches, Mismatch{
+					Kind:     MismatchTransaction,
+					Key:      fmt.Sprintf("%d/%d", i, j),
+					Expected: "payment",
+					Actual:   fmt.Sprintf("%T", op),
+				})
+				continue
+			}
+
+			if op.GetSourceAccount() != "" {
+				mismatches = append(mismatches, Mismatch{Kind: MismatchTransaction, Key: fmt.Sprintf("%d/%d source", i, j), Actual: op.GetSourceAccount()})
+			}
+
+			parsed, err := amount.ParseInt64(amt)
+			if err != nil {
+				return nil, fmt.Errorf("parse amount of operation %d/%d: %w", i, j, err)
+			}
+
+			k := distributeKey(destination, asset.GetCode(), asset.GetIssuer())
+			if _, ok := ops[k]; ok {
+				mismatches = append(mismatches, Mismatch{Kind: MismatchTransaction, Key: k, Expected: "single operation", Actual: "duplicate operation"})
+				continue
+			}
+
+			ops[k] = operationValue(parsed, claimants)
+		}
+	}
+
+	want := make(map[string]string, len(distributes))
+	for _, dist := range distributes {
+		var claimants []txnbuild.Claimant
+		if op, ok := d.distributeOperation(dist).(*txnbuild.CreateClaimableBalance); ok {
+			claimants = op.Destinations
+		}
+
+		want[distributeKey(dist.Recommender, dist.Asset, dist.Issuer)] = operationValue(dist.Amount, claimants)
+	}
+
+	return append(mismatches, diff(MismatchTransaction, want, ops)...), nil
+}
+
+// compareTimeBounds проверяет, что транзакция i действует не дольше TransactionValidity
+// с текущего момента: без верхней границы срока ее можно отправить когда угодно
+func (d *Distributor) compareTimeBounds(i int, bounds txnbuild.TimeBounds) *Mismatch {
+	limit := time.Now().Add(d.cfg.TransactionValidity).Unix()
+	if bounds.MinTime == 0 && bounds.MaxTime != 0 && bounds.MaxTime <= limit {
+		return nil
+	}
+
+	return &Mismatch{
+		Kind:     MismatchTransaction,
+		Key:      strconv.Itoa(i) + " time bounds",
+		Expected: fmt.Sprintf("0-%d", limit),
+		Actual:   fmt.Sprintf("%d-%d", bounds.MinTime, bounds.MaxTime),
+	}
+}
+
+// compareSigned сверяет хэш транзакции i с собранными подписями с хэшем сохраненной
+func (d *Distributor) compareSigned(i int, tx *txnbuild.Transaction, signedXDR string) (*Mismatch, error) {
+	want, err := tx.HashHex(d.cfg.NetworkPassphrase)
+	if err != nil {
+		return nil, fmt.Errorf("hash transaction %d: %w", i, err)
+	}
+
+	key := strconv.Itoa(i) + " signed"
+
+	gtx, err := txnbuild.TransactionFromXDR(signedXDR)
+	if err != nil {
+		return &Mismatch{Kind: MismatchTransaction, Key: key, Expected: want, Actual: "invalid transaction"}, nil
+	}
+
+	signed, ok := gtx.Transaction()
+	if !ok {
+		return &Mismatch{Kind: MismatchTransaction, Key: key, Expected: want, Actual: "fee bump transaction"}, nil
+	}
+
+	hash, err := signed.HashHex(d.cfg.NetworkPassphrase)
+	if err != nil {
+		return nil, fmt.Errorf("hash signed transaction %d: %w", i, err)
+	}
+
+	if hash != want {
+		return &Mismatch{Kind: MismatchTransaction, Key: key, Expected: want, Actual: hash}, nil
+	}
+
+	return nil, nil
+}
+
+// diff возвращает расхождения двух наборов значений в порядке ключей
+func diff(kind string, expected, actual map[string]string) []Mismatch {
+	keys := lo.Uniq(append(lo.Keys(expected), lo.Keys(actual)...))
+	slices.Sort(keys)
+
+	var mismatches []Mismatch
+
+	for _, k := range keys {
+		if expected[k] != actual[k] {
+			mismatches = append(mismatches, Mismatch{
+				Kind:     kind,
+				Key:      k,
+				Expected: expected[k],
+				Actual:   actual[k],
+			})
+		}
+	}
+
+	return mismatches
+}
+
+func recommendValues(rows []db.ReportRecommend) map[string]string {
+	return lo.SliceToMap(rows, func(r db.ReportRecommend) (string, string) {
+		return r.Recommender + " -> " + r.Recommended, strconv.FormatInt(r.RecommendedMtlap, 10)
+	})
+}
+
+func distributeValues(rows []db.ReportDistribute) map[string]string {
+	return lo.SliceToMap(rows, func(r db.ReportDistribute) (string, string) {
+		v := amount.StringFromInt64(r.Amount)
+		if r.Capped > 0 {
+			v += " capped " + amount.StringFromInt64(r.Capped)
+		}
+		return distributeKey(r.Recommender, r.Asset, r.Issuer), v
+	})
+}
+
+func conflictValues(rows []db.ReportConflict) map[string]string {
+	return lo.SliceToMap(rows, func(r db.ReportConflict) (string, string) {
+		return r.Recommender + " -> " + r.Recommended, r.Resolution
+	})
+}
+
+func distributeKey(accountID, asset, issuer string) string {
+	return accountID + " " + asset + ":" + issuer
+}
+
+// operationValue описывает сумму выплаты и, для claimable выплаты, всех получателей с условиями
+func operationValue(amt int64, claimants []txnbuild.Claimant) string {
+	v := amount.StringFromInt64(amt)
+	if claimants == nil {
+		return v
+	}
+
+	v += " claimable"
+	for _, c := range claimants {
+		v += fmt.Sprintf(" [%s %s]", c.Destination, predicateValue(c.Predicate))
+	}
+
+	return v
+}
+
+// predicateValue описывает условие получения claimable balance
+func predicateValue(p xdr.ClaimPredicate) string {
+	switch p.Type {
+	case xdr.ClaimPredicateTypeClaimPredicateUnconditional:
+		return "unconditional"
+	case xdr.ClaimPredicateTypeClaimPredicateBeforeAbsoluteTime:
+		if p.AbsBefore != nil {
+			return fmt.Sprintf("before %d", *p.AbsBefore)
+		}
+	case xdr.ClaimPredicateTypeClaimPredicateBeforeRelativeTime:
+		if p.RelBefore != nil {
+			return fmt.Sprintf("within %ds", *p.RelBefore)
+		}
+	case xdr.ClaimPredicateTypeClaimPredicateNot:
+		if p.NotPredicate != nil && *p.NotPredicate != nil {
+			return "not " + predicateValue(**p.NotPredicate)
+		}
+	case xdr.ClaimPredicateTypeClaimPredicateAnd, xdr.ClaimPredicateTypeClaimPredicateOr:
+		preds := p.AndPredicates
+		sep := " and "
+		if p.Type == xdr.ClaimPredicateTypeClaimPredicateOr {
+			preds, sep = p.OrPredicates, " or "
+		}
+		if preds != nil {
+			return "(" + strings.Join(lo.Map(*preds, func(p xdr.ClaimPredicate, _ int) string { return predicateValue(p) }), sep) + ")"
+		}
+	}
+
+	return "invalid " + p.Type.String()
+}
+
+// memoValue возвращает текст memo или тип memo другого вида
+func memoValue(memo txnbuild.Memo) string {
+	switch m := memo.(type) {
+	case nil:
+		return ""
+	case txnbuild.MemoText:
+		return string(m)
+	default:
+		return fmt.Sprintf("%T", m)
+	}
+}
@@ -0,0 +1,234 @@
+package distributor_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/config"
+	"github.com/mtlprog/mlm/db"
+	"github.com/mtlprog/mlm/distributor"
+	"github.com/mtlprog/mlm/stellar"
+	"github.com/samber/lo"
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareTransactions(t *testing.T) {
+	source := keypair.MustRandom().Address()
+	rec1 := keypair.MustRandom().Address()
+	rec2 := keypair.MustRandom().Address()
+	labr := txnbuild.CreditAsset{Code: stellar.LABRAsset, Issuer: stellar.LABRIssuer}
+	createdAt := time.Date(2026, 10, 17, 12, 0, 0, 0, time.Local)
+
+	d := newDistributor(&config.Config{
+		Address:                source,
+		ClaimableBalancePeriod: time.Hour,
+		TransactionValidity:    time.Hour,
+		NetworkPassphrase:      network.PublicNetworkPassphrase,
+	})
+
+	build := func(t *testing.T, sequence int64, memo string, ops ...txnbuild.Operation) *txnbuild.Transaction {
+		t.Helper()
+
+		tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+			SourceAccount:        &txnbuild.SimpleAccount{AccountID: source, Sequence: sequence},
+			IncrementSequenceNum: true,
+			Operations:           ops,
+			BaseFee:              1000,
+			Memo:                 txnbuild.MemoText(memo),
+			Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewTimeout(600)},
+		})
+		require.NoError(t, err)
+
+		return tx
+	}
+
+	buildXDR := func(t *testing.T, memo string, ops ...txnbuild.Operation) string {
+		t.Helper()
+
+		x, err := build(t, 1, memo, ops...).Base64()
+		require.NoError(t, err)
+
+		return x
+	}
+
+	// pending возвращает невыполненные транзакции отчета по порядку
+	pending := func(xdrs ...string) []db.ReportTransaction {
+		return lo.Map(xdrs, func(x string, i int) db.ReportTransaction {
+			return db.ReportTransaction{ReportID: 1, Chunk: int32(i), Xdr: x, Status: mlm.TransactionPending}
+		})
+	}
+
+	distributes := []db.ReportDistribute{
+		{Recommender: rec1, Asset: stellar.LABRAsset, Issuer: stellar.LABRIssuer, Amount: 10 * amount.One},
+		{Recommender: rec2, Asset: stellar.LABRAsset, Issuer: stellar.LABRIssuer, Amount: 5 * amount.One, Claimable: true},
+	}
+
+	payment := &txnbuild.Payment{Destination: rec1, Amount: "10", Asset: labr}
+	claimable := &txnbuild.CreateClaimableBalance{
+		Amount:       "5",
+		Asset:        labr,
+		Destinations: stellar.ClaimableBalanceClaimants(rec2, source, time.Hour),
+	}
+
+	t.Run("совпадают", func(t *testing.T) {
+		first, err := build(t, 1, "mlta mlm 2026-10-17 1/2", payment).Base64()
+		require.NoError(t, err)
+		second, err := build(t, 2, "mlta mlm 2026-10-17 2/2", claimable).Base64()
+		require.NoError(t, err)
+
+		mismatches, err := d.CompareTransactions(pending(first, second), createdAt, distributes)
+		require.NoError(t, err)
+		require.Empty(t, mismatches)
+	})
+
+	t.Run("другая сумма и лишняя операция", func(t *testing.T) {
+		mismatches, err := d.CompareTransactions(pending(buildXDR(t, "mlta mlm 2026-10-17",
+			&txnbuild.Payment{Destination: rec1, Amount: "11", Asset: labr},
+			claimable,
+			&txnbuild.Payment{Destination: source, Amount: "1", Asset: labr},
+		)), createdAt, distributes)
+		require.NoError(t, err)
+		require.Len(t, mismatches, 2)
+
+		for _, m := range mismatches {
+			require.Equal(t, distributor.MismatchTransaction, m.Kind)
+
+			switch m.Key {
+			case rec1 + " LABR:" + stellar.LABRIssuer:
+				require.Equal(t, "10.0000000", m.Expected)
+				require.Equal(t, "11.0000000", m.Actual)
+			case source + " LABR:" + stellar.LABRIssuer:
+				require.Empty(t, m.Expected)
+			default:
+				t.Fatalf("unexpected mismatch %+v", m)
+			}
+		}
+	})
+
+	t.Run("выплата вместо claimable и чужой источник", func(t *testing.T) {
+		other := newDistributor(&config.Config{Address: rec1, ClaimableBalancePeriod: time.Hour, TransactionValidity: time.Hour})
+
+		mismatches, err := other.CompareTransactions(pending(buildXDR(t, "mlta mlm 2026-10-17",
+			payment,
+			&txnbuild.Payment{Destination: rec2, Amount: "5", Asset: labr},
+		)), createdAt, distributes)
+		require.NoError(t, err)
+		require.Len(t, mismatches, 2)
+		require.Equal(t, "0 source", mismatches[0].Key)
+		require.True(t, strings.HasPrefix(mismatches[1].Expected, "5.0000000 claimable"))
+		require.Equal(t, "5.0000000", mismatches[1].Actual)
+	})
+
+	t.Run("подмененный получатель claimable", func(t *testing.T) {
+		attacker := keypair.MustRandom().Address()
+		stolen := &txnbuild.CreateClaimableBalance{
+			Amount:       "5",
+			Asset:        labr,
+			Destinations: stellar.ClaimableBalanceClaimants(rec2, attacker, time.Hour),
+		}
+
+		mismatches, err := d.CompareTransactions(pending(buildXDR(t, "mlta mlm 2026-10-17", payment, stolen)), createdAt, distributes)
+		require.NoError(t, err)
+		require.Len(t, mismatches, 1)
+		require.Equal(t, rec2+" LABR:"+stellar.LABRIssuer, mismatches[0].Key)
+		require.Contains(t, mismatches[0].Actual, attacker)
+	})
+
+	t.Run("другие комиссия и memo", func(t *testing.T) {
+		tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+			SourceAccount:        &txnbuild.SimpleAccount{AccountID: source, Sequence: 1},
+			IncrementSequenceNum: true,
+			Operations:           []txnbuild.Operation{payment, claimable},
+			BaseFee:              100000,
+			Memo:                 txnbuild.MemoText("other"),
+			Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewTimeout(600)},
+		})
+		require.NoError(t, err)
+		x, err := tx.Base64()
+		require.NoError(t, err)
+
+		mismatches, err := d.CompareTransactions(pending(x), createdAt, distributes)
+		require.NoError(t, err)
+		require.Equal(t, []distributor.Mismatch{
+			{Kind: distributor.MismatchTransaction, Key: "0 fee", Expected: "1000", Actual: "100000"},
+			{Kind: distributor.MismatchTransaction, Key: "0 memo", Expected: "mlta mlm 2026-10-17", Actual: "other"},
+		}, mismatches)
+	})
+
+	t.Run("разрыв sequence number", func(t *testing.T) {
+		first, err := build(t, 1, "mlta mlm 2026-10-17 1/2", payment).Base64()
+		require.NoError(t, err)
+		second, err := build(t, 5, "mlta mlm 2026-10-17 2/2", claimable).Base64()
+		require.NoError(t, err)
+
+		txs := pending(first, second)
+
+		mismatches, err := d.CompareTransactions(txs, createdAt, distributes)
+		require.NoError(t, err)
+		require.Equal(t, []distributor.Mismatch{
+			{Kind: distributor.MismatchTransaction, Key: "1 sequence", Expected: "3", Actual: "6"},
+		}, mismatches)
+
+		txs[0].Status = mlm.TransactionSuccess
+
+		mismatches, err = d.CompareTransactions(txs, createdAt, distributes)
+		require.NoError(t, err)
+		require.Empty(t, mismatches, "пересобранные транзакции начинаются после выполненной")
+	})
+
+	t.Run("бессрочная транзакция", func(t *testing.T) {
+		tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+			SourceAccount:        &txnbuild.SimpleAccount{AccountID: source, Sequence: 1},
+			IncrementSequenceNum: true,
+			Operations:           []txnbuild.Operation{payment, claimable},
+			BaseFee:              1000,
+			Memo:                 txnbuild.MemoText("mlta mlm 2026-10-17"),
+			Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+		})
+		require.NoError(t, err)
+		x, err := tx.Base64()
+		require.NoError(t, err)
+
+		mismatches, err := d.CompareTransactions(pending(x), createdAt, distributes)
+		require.NoError(t, err)
+		require.Len(t, mismatches, 1)
+		require.Equal(t, "0 time bounds", mismatches[0].Key)
+	})
+
+	t.Run("подмененная подписанная транзакция", func(t *testing.T) {
+		signer := keypair.MustRandom()
+
+		tx := build(t, 1, "mlta mlm 2026-10-17", payment, claimable)
+		signed, err := tx.Sign(network.PublicNetworkPassphrase, signer)
+		require.NoError(t, err)
+		signedXDR, err := signed.Base64()
+		require.NoError(t, err)
+
+		txs := pending(buildXDR(t, "mlta mlm 2026-10-17", payment, claimable))
+		txs[0].SignedXdr = pgtype.Text{String: signedXDR, Valid: true}
+
+		mismatches, err := d.CompareTransactions(txs, createdAt, distributes)
+		require.NoError(t, err)
+		require.Empty(t, mismatches, "подписи не меняют хэш")
+
+		swapped, err := build(t, 1, "mlta mlm 2026-10-17",
+			&txnbuild.Payment{Destination: signer.Address(), Amount: "10", Asset: labr}, claimable,
+		).Sign(network.PublicNetworkPassphrase, signer)
+		require.NoError(t, err)
+		swappedXDR, err := swapped.Base64()
+		require.NoError(t, err)
+		txs[0].SignedXdr = pgtype.Text{String: swappedXDR, Valid: true}
+
+		mismatches, err = d.CompareTransactions(txs, createdAt, distributes)
+		require.NoError(t, err)
+		require.Len(t, mismatches, 1)
+		require.Equal(t, "0 signed", mismatches[0].Key)
+	})
+}
@@ -0,0 +1,154 @@
+package distributor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/db"
+	"github.com/mtlprog/mlm/stellar"
+)
+
+// vestingEnabled возвращает, нужно ли удерживать MTLAP до того, как рост уровня принесет награду
+func (d *Distributor) vestingEnabled() bool {
+	return d.cfg.VestingPeriod > 0 || d.cfg.VestingReports > 0
+}
+
+// vest применяет к рекомендациям срок удержания MTLAP, если он включен,
+// и возвращает неудержанный рост
+func (d *Distributor) vest(
+	ctx context.Context,
+	beforeReportID int64,
+	at time.Time,
+	recs *mlm.RecommendersFetchResult,
+	highWater map[string]int64,
+) ([]mlm.RecommendDelta, error) {
+	if !d.vestingEnabled() {
+		return nil, nil
+	}
+
+	snapshots, err := d.getVestingSnapshots(ctx, beforeReportID, at)
+	if err != nil {
+		return nil, err
+	}
+
+	return ApplyVesting(recs, highWater, VestedMTLAP(snapshots)), nil
+}
+
+// getVestingSnapshots возвращает снимки прошлых отчетов, за которые MTLAP должен удерживаться:
+// последние VestingReports снимков или все снимки за VestingPeriod вместе с последним снимком
+// до его начала. Если истории меньше срока удержания, возвращает nil — тогда рост MTLAP
+// не засчитывается никому. Если beforeReportID не 0, учитываются только отчеты до него.
+func (d *Distributor) getVestingSnapshots(ctx context.Context, beforeReportID int64, at time.Time) ([]*mlm.Snapshot, error) {
+	params := db.GetVestingSnapshotsParams{
+		BeforeReportID: beforeReportID,
+		Since:          pgtype.Timestamptz{InfinityModifier: pgtype.NegativeInfinity, Valid: true},
+		QueryLimit:     math.MaxInt32,
+	}
+
+	if d.cfg.VestingReports > 0 {
+		params.QueryLimit = int32(d.cfg.VestingReports)
+	}
+
+	if d.cfg.VestingPeriod > 0 {
+		start, err := d.q.GetLatestSnapshotReport(ctx, db.GetLatestSnapshotReportParams{
+			BeforeReportID: beforeReportID,
+			CreatedAt:      pgtype.Timestamptz{Time: at.Add(-d.cfg.VestingPeriod), Valid: true},
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		params.Since = start.CreatedAt
+	}
+
+	rows, err := d.q.GetVestingSnapshots(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.cfg.VestingReports > 0 && len(rows) < d.cfg.VestingReports {
+		return nil, nil
+	}
+
+	snapshots := make([]*mlm.Snapshot, 0, len(rows))
+	for _, row := range rows {
+		snapshot, err := SnapshotFromRow(row)
+		if err != nil {
+			return nil, fmt.Errorf("decode snapshot of report %d: %w", row.ReportID, err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, nil
+}
+
+// VestedMTLAP возвращает MTLAP, который каждый счет удерживал во всех снимках срока удержания.
+// Счет, которого нет хотя бы в одном снимке, ничего не удерживал.
+func VestedMTLAP(snapshots []*mlm.Snapshot) map[string]int64 {
+	vested := make(map[string]int64)
+
+	for i, snapshot := range snapshots {
+		balances := stellar.MTLAPBalances(snapshot)
+
+		if i == 0 {
+			vested = balances
+			continue
+		}
+
+		for accountID, mtlap := range vested {
+			vested[accountID] = min(mtlap, balances[accountID])
+		}
+	}
+
+	return vested
+}
+
+// ApplyVesting засчитывает рост MTLAP выше исторического максимума только в пределах
+// удержанного MTLAP. Неудержанный рост возвращается как ожидающий удержания, а новые
+// рекомендуемые без удержанного MTLAP не попадают в отчет, пока его не накопят.
+func ApplyVesting(recs *mlm.RecommendersFetchResult, highWater, vested map[string]int64) []mlm.RecommendDelta {
+	pending := make([]mlm.RecommendDelta, 0)
+
+	for i, recommender := range recs.Recommenders {
+		recommendeds := make([]mlm.Recommended, 0, len(recommender.Recommended))
+
+		for _, recommended := range recommender.Recommended {
+			last, ok := highWater[recommended.AccountID]
+			if recommended.MTLAP <= last {
+				recommendeds = append(recommendeds, recommended)
+				continue
+			}
+
+			counted := max(last, min(recommended.MTLAP, vested[recommended.AccountID]))
+
+			if counted < recommended.MTLAP {
+				pending = append(pending, mlm.RecommendDelta{
+					Recommender: recommender.AccountID,
+					Recommended: recommended.AccountID,
+					Delta:       recommended.MTLAP - counted,
+					Level:       1,
+				})
+			}
+
+			if !ok && counted == 0 {
+				continue
+			}
+
+			recommended.MTLAP = counted
+			recommendeds = append(recommendeds, recommended)
+		}
+
+		recs.Recommenders[i].Recommended = recommendeds
+	}
+
+	return pending
+}
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE report_transactions (
+  report_id bigint NOT NULL,
+  chunk integer NOT NULL,
+  xdr text NOT NULL,
+  hash text,
+  updated_at timestamp with time zone
+);
+
+CREATE UNIQUE INDEX idx_report_transactions_report_id_chunk
+ON report_transactions (report_id, chunk);
+
+INSERT INTO report_transactions (report_id, chunk, xdr, hash, updated_at)
+SELECT id, 0, xdr, hash, updated_at FROM reports;
+
+ALTER TABLE reports
+  DROP COLUMN xdr,
+  DROP COLUMN hash;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE reports
+  ADD COLUMN carryover double precision NOT NULL DEFAULT 0;
+
+ALTER TABLE report_distributes
+  ADD COLUMN capped double precision NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE report_distributes
+  ALTER COLUMN amount TYPE bigint USING floor(amount * 10000000)::bigint,
+  ALTER COLUMN capped TYPE bigint USING floor(capped * 10000000)::bigint;
+
+ALTER TABLE reports
+  ALTER COLUMN carryover TYPE bigint USING floor(carryover * 10000000)::bigint;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE carryover (
+  report_id bigint NOT NULL,
+  recommender text,
+  amount numeric NOT NULL
+);
+
+CREATE INDEX idx_carryover_report_id
+ON carryover (report_id);
+
+INSERT INTO carryover (report_id, recommender, amount)
+SELECT id, NULL, carryover FROM reports
+WHERE carryover > 0;
+
+ALTER TABLE reports
+  DROP COLUMN carryover;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE arrears (
+  report_id bigint NOT NULL,
+  recommender text NOT NULL,
+  asset text NOT NULL,
+  amount bigint NOT NULL,
+  created_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX idx_arrears_report_id
+ON arrears (report_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
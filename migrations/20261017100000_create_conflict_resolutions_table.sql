@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE conflict_resolutions (
+  recommended text NOT NULL PRIMARY KEY,
+  recommender text NOT NULL,
+  created_at timestamp with time zone NOT NULL
+);
+
+ALTER TABLE report_conflicts
+  ADD COLUMN resolution text NOT NULL DEFAULT 'skip';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
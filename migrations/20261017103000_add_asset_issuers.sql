@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE report_distributes
+  ADD COLUMN issuer text NOT NULL DEFAULT 'GA7I6SGUHQ26ARNCD376WXV5WSE7VJRX6OEFNFCEGRLFGZWQIV73LABR';
+
+ALTER TABLE report_distributes
+  ALTER COLUMN issuer DROP DEFAULT;
+
+ALTER TABLE arrears
+  ADD COLUMN issuer text NOT NULL DEFAULT 'GA7I6SGUHQ26ARNCD376WXV5WSE7VJRX6OEFNFCEGRLFGZWQIV73LABR';
+
+ALTER TABLE arrears
+  ALTER COLUMN issuer DROP DEFAULT;
+
+ALTER TABLE carryover
+  ADD COLUMN asset text NOT NULL DEFAULT 'LABR',
+  ADD COLUMN issuer text NOT NULL DEFAULT 'GA7I6SGUHQ26ARNCD376WXV5WSE7VJRX6OEFNFCEGRLFGZWQIV73LABR';
+
+ALTER TABLE carryover
+  ALTER COLUMN asset DROP DEFAULT,
+  ALTER COLUMN issuer DROP DEFAULT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
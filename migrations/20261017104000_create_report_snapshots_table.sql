@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE report_snapshots (
+  report_id bigint NOT NULL PRIMARY KEY,
+  ledger bigint NOT NULL,
+  accounts jsonb NOT NULL,
+  created_at timestamp with time zone NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
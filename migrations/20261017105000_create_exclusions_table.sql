@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE exclusions (
+  account_id text NOT NULL PRIMARY KEY,
+  reason text NOT NULL,
+  author text NOT NULL,
+  expires_at timestamp with time zone,
+  created_at timestamp with time zone NOT NULL
+);
+
+CREATE TABLE report_exclusions (
+  report_id bigint NOT NULL,
+  account_id text NOT NULL,
+  reason text NOT NULL
+);
+
+CREATE INDEX idx_report_exclusions_report_id
+ON report_exclusions (report_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
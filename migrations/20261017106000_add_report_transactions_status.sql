@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE report_transactions
+  ADD COLUMN status text NOT NULL DEFAULT 'pending';
+
+UPDATE report_transactions
+SET status = 'success'
+WHERE hash IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+-- +goose StatementEnd
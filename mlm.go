@@ -3,6 +3,7 @@ package mlm
 import (
 	"context"
 	"embed"
+	"math/big"
 	"time"
 
 	"github.com/mtlprog/mlm/db"
@@ -25,8 +26,54 @@ type Recommender struct {
 
 type RecommendersFetchResult struct {
 	Conflict              map[string][]string // recommended-recommender
+	ConflictWinners       map[string]string   // recommended-recommender, выбранный политикой конфликтов
+	Excluded              map[string]string   // account-reason, счета, отстраненные от наград
 	Recommenders          []Recommender
 	TotalRecommendedMTLAP int64
+	Snapshot              *Snapshot // исходные данные, из которых построен граф
+}
+
+// Виды нарушений в графе рекомендаций
+const (
+	GraphIssueSelfLoop = "self_loop" // аккаунт рекомендует сам себя
+	GraphIssueMutual   = "mutual"    // два аккаунта рекомендуют друг друга
+	GraphIssueCycle    = "cycle"     // три и больше аккаунтов рекомендуют друг друга по кругу
+)
+
+// Политики для нарушений в графе рекомендаций
+const (
+	GraphPolicyIgnore  = "ignore"  // не проверять
+	GraphPolicyExclude = "exclude" // убрать рекомендации нарушения из графа
+	GraphPolicyFlag    = "flag"    // только показать в отчете
+)
+
+// GraphPolicy — политика для каждого вида нарушений в графе рекомендаций
+type GraphPolicy struct {
+	SelfLoop string
+	Mutual   string
+	Cycle    string
+}
+
+// GraphIssue — найденное в графе рекомендаций нарушение. Excluded означает,
+// что рекомендации между Accounts убраны из расчета.
+type GraphIssue struct {
+	Kind     string
+	Accounts []string
+	Excluded bool
+}
+
+// SnapshotAccount — держатель MTLAP в том виде, в каком его видел расчет рекомендаций
+type SnapshotAccount struct {
+	AccountID string            `json:"id"`
+	MTLAP     string            `json:"mtlap"`          // баланс MTLAP как его вернул Horizon
+	Data      map[string]string `json:"data,omitempty"` // записи RecommendToMTLA* в base64
+}
+
+// Snapshot — снимок Horizon, из которого построен граф рекомендаций отчета.
+// Ledger — последний ledger в Horizon на начало обхода держателей MTLAP.
+type Snapshot struct {
+	Ledger   int64
+	Accounts []SnapshotAccount
 }
 
 type StellarAgregator interface {
@@ -34,35 +81,160 @@ type StellarAgregator interface {
 	HasTrustline(ctx context.Context, accountID, asset, issuer string) (bool, error)
 	Recommenders(ctx context.Context) (*RecommendersFetchResult, error)
 	AccountDetail(accountID string) (horizon.Account, error)
+	GetSwapPriceForAmount(ctx context.Context, sourceCode, sourceIssuer, destCode, destIssuer string, sourceAmount int64) (int64, error)
 }
 
 type HorizonClient interface {
 	horizonclient.ClientInterface
+	ClaimableBalances(cbr horizonclient.ClaimableBalanceRequest) (horizon.ClaimableBalances, error)
+	StrictSendPaths(request horizonclient.StrictSendPathsRequest) (horizon.PathsPage, error)
+}
+
+// Решения по конфликтующим рекомендациям, сохраняются в report_conflicts.resolution
+const (
+	ConflictResolutionSkip  = "skip"  // рекомендация не учитывается
+	ConflictResolutionSplit = "split" // награда делится поровну между рекомендателями
+	ConflictResolutionWon   = "won"   // рекомендатель выбран политикой конфликтов
+	ConflictResolutionLost  = "lost"  // выбран другой рекомендатель
+)
+
+// Состояния транзакций отчета, сохраняются в report_transactions.status
+const (
+	TransactionPending = "pending" // еще не отправлялась или пересобрана
+	TransactionSuccess = "success" // выполнена
+	TransactionFailed  = "failed"  // отклонена или истекла и в сеть уже не попадет
+	TransactionUnknown = "unknown" // результат отправки неизвестен, транзакция могла попасть в сеть
+)
+
+// Asset — актив Stellar
+type Asset struct {
+	Code   string `json:"code"`
+	Issuer string `json:"issuer"`
+}
+
+func (a Asset) String() string {
+	return a.Code + ":" + a.Issuer
 }
 
 type MissingTrustline struct {
 	AccountID string
-	Asset     string
+	Asset     Asset
+}
+
+// Arrear — выплата, удержанная из-за отсутствия линии доверия.
+// CreatedAt — время первого удержания, от него считается срок хранения.
+type Arrear struct {
+	AccountID string
+	Asset     Asset
+	Amount    int64
+	CreatedAt time.Time
 }
 
-// RecommendDelta содержит информацию об изменении MTLAP для отображения в отчете
+// RecommendDelta содержит информацию об изменении MTLAP для отображения в отчете.
+// Level — глубина рекомендателя в цепочке: 1 у прямого рекомендателя, 2 и выше —
+// у вышестоящих, получивших часть награды через прямого рекомендателя Via.
 type RecommendDelta struct {
 	Recommender string
 	Recommended string
 	Delta       int64
+	Level       int
+	Via         string
+}
+
+// RewardChange описывает изменение MTLAP рекомендуемого с момента прошлого распределения
+type RewardChange struct {
+	Recommender string
+	Recommended string
+	LastMTLAP   int64
+	MTLAP       int64
+	New         bool
+}
+
+// RewardPolicy определяет формулу награды: сколько долей бюджета получает рекомендатель
+// за изменения MTLAP своих рекомендуемых. Бюджет делится пропорционально долям.
+type RewardPolicy interface {
+	Name() string
+	Parts(changes []RewardChange) float64
+}
+
+// Owed — начисленная рекомендателю, но еще не выплаченная сумма в строупах.
+// Может быть дробной: доля меньше строупа копится до следующих отчетов.
+type Owed struct {
+	AccountID string
+	Amount    *big.Rat
+}
+
+// Budget — политика бюджета распределения актива и ее входные данные на момент отчета.
+// Суммы в строупах.
+type Budget struct {
+	Asset      Asset   `json:"asset"`
+	Policy     string  `json:"policy"`
+	Balance    int64   `json:"balance"`
+	Amount     int64   `json:"amount,omitempty"`  // fixed
+	Percent    float64 `json:"percent,omitempty"` // percent
+	Reserve    int64   `json:"reserve,omitempty"` // reserve
+	EUR        int64   `json:"eur,omitempty"`     // eur
+	EURInAsset int64   `json:"eur_in_asset,omitempty"`
+}
+
+// AssetDistribution — распределение одного актива награды. Суммы в строупах актива.
+type AssetDistribution struct {
+	Asset        Asset
+	Budget       Budget
+	Amount       int64
+	AmountPerTag int64
+	PayoutCap    int64
+	Carryover    int64
+	Owed         []Owed // включая накопленные до MinPayout суммы
+	MinPayout    int64
+	Dust         int64
+}
+
+// MovedRecommendation — рекомендуемый, которого теперь засчитывают другим рекомендателям
+type MovedRecommendation struct {
+	Recommended string
+	From        []string
+	To          []string
+}
+
+// MTLAPDrop — падение MTLAP рекомендуемого между отчетами
+type MTLAPDrop struct {
+	Recommended string
+	From        int64
+	To          int64
+}
+
+// ReportDiff — изменения отчета To по сравнению с отчетом From. To равен 0 для еще не
+// сохраненного отчета. Конфликты указаны рекомендуемыми.
+type ReportDiff struct {
+	From                 int64
+	To                   int64
+	NewRecommenders      []string
+	VanishedRecommenders []string
+	Moved                []MovedRecommendation
+	MTLAPDrops           []MTLAPDrop
+	ConflictsAppeared    []string
+	ConflictsResolved    []string
 }
 
 type DistributeResult struct {
 	CreatedAt               time.Time
-	XDR                     string
+	XDRs                    []string
 	Conflicts               []db.ReportConflict
 	Recommends              []db.ReportRecommend
 	Distributes             []db.ReportDistribute
 	MissingTrustlines       []MissingTrustline
+	Arrears                 []Arrear
+	ArrearsPaid             []Arrear
+	ArrearsExpired          []Arrear
 	RecommendDeltas         []RecommendDelta
+	PendingVesting          []RecommendDelta // рост MTLAP, еще не удержанный нужный срок
+	GraphIssues             []GraphIssue
+	Exclusions              []db.ReportExclusion
+	Diff                    *ReportDiff
 	ReportID                int64
-	Amount                  float64
-	AmountPerTag            float64
+	Assets                  []AssetDistribution
+	RewardPolicy            string
 	RecommendedNewCount     int64
 	RecommendedLevelUpCount int64
 	SourceAddress           string
@@ -70,6 +242,7 @@ type DistributeResult struct {
 
 type DistributeOptions struct {
 	WithoutReport bool
+	WithDiff      bool
 }
 
 type DistributeOption func(*DistributeOptions)
@@ -80,6 +253,13 @@ func WithoutReport() DistributeOption {
 	}
 }
 
+// WithDiff добавляет к результату изменения по сравнению с прошлым отчетом
+func WithDiff() DistributeOption {
+	return func(o *DistributeOptions) {
+		o.WithDiff = true
+	}
+}
+
 type Distributor interface {
 	Distribute(ctx context.Context, opts ...DistributeOption) (*DistributeResult, error)
 }
@@ -20,27 +20,75 @@ WHERE deleted_at IS NULL AND
   id = @id;
 
 -- name: GetPendingReport :one
-SELECT * FROM reports
-WHERE deleted_at IS NULL
-  AND hash IS NULL
-  AND created_at > now() - interval '24 hours'
-ORDER BY created_at DESC
+SELECT r.* FROM reports r
+WHERE r.deleted_at IS NULL
+  AND EXISTS (
+    SELECT 1 FROM report_transactions t
+    WHERE t.report_id = r.id AND t.status <> 'success'
+  )
+  AND (
+    r.created_at > now() - interval '24 hours'
+    OR EXISTS (
+      SELECT 1 FROM report_transactions t
+      WHERE t.report_id = r.id AND t.status IN ('success', 'unknown')
+    )
+  )
+ORDER BY r.created_at DESC
+LIMIT 1;
+
+-- name: GetLastPaidReport :one
+SELECT r.* FROM reports r
+WHERE r.deleted_at IS NULL
+  AND (@before_report_id::bigint = 0::bigint OR r.id < @before_report_id)
+  AND EXISTS (
+    SELECT 1 FROM report_transactions t
+    WHERE t.report_id = r.id AND t.status = 'success'
+  )
+ORDER BY r.id DESC
 LIMIT 1;
 
 -- name: CreateReport :one
-INSERT INTO reports (created_at, xdr)
-  VALUES (now(), @xdr) RETURNING id;
+INSERT INTO reports (created_at, budget)
+  VALUES (now(), @budget) RETURNING id;
 
 -- name: DeleteReport :exec
 UPDATE reports
 SET deleted_at = now()
 WHERE id = @id;
 
--- name: SetReportHash :exec
-UPDATE reports
+-- name: GetReportTransactions :many
+SELECT * FROM report_transactions
+WHERE report_id = @report_id
+ORDER BY chunk;
+
+-- name: CreateReportTransaction :exec
+INSERT INTO report_transactions (report_id, chunk, xdr)
+  VALUES (@report_id, @chunk, @xdr);
+
+-- name: SetReportTransactionStatus :exec
+UPDATE report_transactions
 SET hash = @hash,
+  status = @status,
   updated_at = now()
-WHERE id = @report_id;
+WHERE report_id = @report_id
+  AND chunk = @chunk;
+
+-- name: SetReportTransactionSignedXDR :exec
+UPDATE report_transactions
+SET signed_xdr = @signed_xdr,
+  updated_at = now()
+WHERE report_id = @report_id
+  AND chunk = @chunk;
+
+-- name: UpdateReportTransactionXDR :exec
+UPDATE report_transactions
+SET xdr = @xdr,
+  signed_xdr = NULL,
+  hash = NULL,
+  status = 'pending',
+  updated_at = now()
+WHERE report_id = @report_id
+  AND chunk = @chunk;
 
 -- name: GetReportRecommends :many
 SELECT * FROM report_recommends
@@ -55,16 +103,121 @@ SELECT * FROM report_distributes
 WHERE report_id = @report_id;
 
 -- name: CreateReportDistribute :exec
-INSERT INTO report_distributes (report_id, recommender, asset, amount)
-  VALUES (@report_id, @recommender, @asset, @amount);
+INSERT INTO report_distributes (report_id, recommender, asset, issuer, amount, capped, claimable)
+  VALUES (@report_id, @recommender, @asset, @issuer, @amount, @capped, @claimable);
 
 -- name: GetReportConflicts :many
 SELECT * FROM report_conflicts
 WHERE report_id = @report_id;
 
 -- name: CreateReportConflict :exec
-INSERT INTO report_conflicts (report_id, recommender, recommended)
-  VALUES (@report_id, @recommender, @recommended);
+INSERT INTO report_conflicts (report_id, recommender, recommended, resolution)
+  VALUES (@report_id, @recommender, @recommended, @resolution);
+
+-- name: GetConflictResolutions :many
+SELECT * FROM conflict_resolutions;
+
+-- name: SetConflictResolution :exec
+INSERT INTO conflict_resolutions (recommended, recommender, created_at)
+  VALUES (@recommended, @recommender, now())
+ON CONFLICT (recommended) DO UPDATE
+SET recommender = excluded.recommender,
+  created_at = excluded.created_at;
+
+-- name: GetExclusions :many
+SELECT * FROM exclusions
+ORDER BY created_at;
+
+-- name: GetActiveExclusions :many
+SELECT * FROM exclusions
+WHERE expires_at IS NULL OR expires_at > now()
+ORDER BY account_id;
+
+-- name: SetExclusion :exec
+INSERT INTO exclusions (account_id, reason, author, expires_at, created_at)
+  VALUES (@account_id, @reason, @author, @expires_at, now())
+ON CONFLICT (account_id) DO UPDATE
+SET reason = excluded.reason,
+  author = excluded.author,
+  expires_at = excluded.expires_at,
+  created_at = excluded.created_at;
+
+-- name: DeleteExclusion :execrows
+DELETE FROM exclusions
+WHERE account_id = @account_id;
+
+-- name: CreateReportExclusion :exec
+INSERT INTO report_exclusions (report_id, account_id, reason)
+  VALUES (@report_id, @account_id, @reason);
+
+-- name: GetReportExclusions :many
+SELECT * FROM report_exclusions
+WHERE report_id = @report_id
+ORDER BY account_id;
+
+-- name: GetMTLAPHighWaterMarks :many
+SELECT rr.recommended, max(rr.recommended_mtlap)::bigint AS mtlap
+FROM report_recommends rr
+JOIN reports r ON r.id = rr.report_id
+WHERE r.deleted_at IS NULL
+  AND (@before_report_id::bigint = 0::bigint OR r.id < @before_report_id)
+  AND EXISTS (
+    SELECT 1 FROM report_transactions t
+    WHERE t.report_id = r.id AND t.status = 'success'
+  )
+GROUP BY rr.recommended;
+
+-- name: GetFirstRecommendations :many
+SELECT rr.recommender, rr.recommended, min(r.created_at)::timestamptz AS first_at
+FROM report_recommends rr
+JOIN reports r ON r.id = rr.report_id
+WHERE r.deleted_at IS NULL
+  AND (@before_report_id::bigint = 0::bigint OR r.id < @before_report_id)
+  AND rr.recommended = ANY(@recommended::text[])
+GROUP BY rr.recommender, rr.recommended;
+
+-- name: GetCarryover :many
+SELECT * FROM carryover
+WHERE report_id = @report_id;
+
+-- name: CreateCarryover :exec
+INSERT INTO carryover (report_id, recommender, asset, issuer, amount)
+  VALUES (@report_id, @recommender, @asset, @issuer, @amount);
+
+-- name: GetArrears :many
+SELECT * FROM arrears
+WHERE report_id = @report_id
+ORDER BY created_at;
+
+-- name: CreateArrear :exec
+INSERT INTO arrears (report_id, recommender, asset, issuer, amount, created_at)
+  VALUES (@report_id, @recommender, @asset, @issuer, @amount, @created_at);
+
+-- name: GetReportSnapshot :one
+SELECT * FROM report_snapshots
+WHERE report_id = @report_id;
+
+-- name: GetLatestSnapshotReport :one
+SELECT r.* FROM reports r
+JOIN report_snapshots s ON s.report_id = r.id
+WHERE r.deleted_at IS NULL
+  AND (@before_report_id::bigint = 0::bigint OR r.id < @before_report_id)
+  AND r.created_at <= @created_at::timestamptz
+ORDER BY r.id DESC
+LIMIT 1;
+
+-- name: GetVestingSnapshots :many
+SELECT s.* FROM report_snapshots s
+JOIN reports r ON r.id = s.report_id
+WHERE r.deleted_at IS NULL
+  AND (@before_report_id::bigint = 0::bigint OR r.id < @before_report_id)
+  AND r.created_at >= @since::timestamptz
+ORDER BY r.id DESC
+LIMIT @query_limit;
+
+-- name: CreateReportSnapshot :exec
+INSERT INTO report_snapshots (report_id, ledger, accounts, created_at)
+  VALUES (@report_id, @ledger, @accounts, now());
 
 -- name: LockReport :exec
 SELECT pg_advisory_lock(1);
@@ -2,10 +2,16 @@ package report
 
 import (
 	"fmt"
+	"html"
+	"math/big"
 	"strings"
 	"time"
 
 	"github.com/mtlprog/mlm"
+	"github.com/mtlprog/mlm/config"
+	"github.com/mtlprog/mlm/db"
+	"github.com/mtlprog/mlm/stellar"
+	"github.com/samber/lo"
 )
 
 const bsnViewerPrefix = "https://bsn.expert/accounts/"
@@ -24,48 +30,144 @@ func FromDistributeResult(res mlm.DistributeResult) string {
 Счёт программы: <a href="%s">%s</a>
 Дата: %s
 Распределение: %s
-Сумма: %f LABR
 Рекомендателей: %d
 Рекомендаций: %d
 Новые участники: %d
 Участники с повышением уровня: %d
-Выплата за тег: %f LABR`,
+Формула награды: %s`,
 		strings.Join([]string{bsnViewerPrefix, res.SourceAddress}, ""),
 		accountAbbr(res.SourceAddress),
 		res.CreatedAt.Format(time.DateOnly),
 		nextDistributionDate(res.CreatedAt).Format(time.DateOnly),
-		res.Amount,
-		len(res.Distributes),
+		len(lo.Uniq(lo.Map(res.Distributes, func(d db.ReportDistribute, _ int) string { return d.Recommender }))),
 		len(res.Recommends),
 		res.RecommendedNewCount,
 		res.RecommendedLevelUpCount,
-		res.AmountPerTag)
+		res.RewardPolicy)
+
+	for _, a := range res.Assets {
+		fmt.Fprintf(rep, "\n\nСумма: %s %s", stellar.FormatAmount(a.Amount, 7), a.Asset.Code)
+
+		if a.Budget.Policy != "" {
+			fmt.Fprintf(rep, "\nБюджет: %s", budgetDescription(a.Budget))
+		}
+
+		fmt.Fprintf(rep, "\nВыплата за долю: %s %s", stellar.FormatAmount(a.AmountPerTag, 7), a.Asset.Code)
+
+		if a.Dust > 0 {
+			fmt.Fprintf(rep, "\nОстаток от округления: %s %s", stellar.FormatAmount(a.Dust, 7), a.Asset.Code)
+		}
+	}
 
 	if len(res.Conflicts) > 0 {
 		fmt.Fprintf(rep, "\n\n<b>Конфликты</b>\n")
 
 		for _, c := range res.Conflicts {
-			fmt.Fprintf(rep, "\n<a href=\"%s\">%s</a> -> <a href=\"%s\">%s</a>",
+			fmt.Fprintf(rep, "\n<a href=\"%s\">%s</a> -> <a href=\"%s\">%s</a>%s",
 				strings.Join([]string{bsnViewerPrefix, c.Recommender}, ""),
 				accountAbbr(c.Recommender),
 				strings.Join([]string{bsnViewerPrefix, c.Recommended}, ""),
-				accountAbbr(c.Recommended))
+				accountAbbr(c.Recommended),
+				conflictResolutionLabel(c.Resolution))
 		}
 	}
 
-	if len(res.MissingTrustlines) > 0 {
-		fmt.Fprintf(rep, "\n\n<b>Нет линии доверия к %s</b>\n", res.MissingTrustlines[0].Asset)
+	for _, asset := range missingTrustlineAssets(res.MissingTrustlines) {
+		fmt.Fprintf(rep, "\n\n<b>Нет линии доверия к %s</b>\n", asset.Code)
 
 		for _, mt := range res.MissingTrustlines {
+			if mt.Asset != asset {
+				continue
+			}
+
 			fmt.Fprintf(rep, "\n<a href=\"%s\">%s</a>",
 				strings.Join([]string{bsnViewerPrefix, mt.AccountID}, ""),
 				accountAbbr(mt.AccountID))
 		}
 	}
 
-	if len(res.Distributes) > 0 {
-		fmt.Fprintf(rep, "\n\n<b>Распределение</b>\n")
+	writeArrears(rep, "Удержано до открытия линии доверия", res.Arrears)
+	writeArrears(rep, "Выплата удержанных наград", res.ArrearsPaid)
+	writeArrears(rep, "Списано по истечении срока", res.ArrearsExpired)
+
+	for _, a := range res.Assets {
+		distributes := assetDistributes(res.Distributes, a.Asset)
+
+		if !hasCapped(distributes) {
+			continue
+		}
+
+		fmt.Fprintf(rep, "\n\n<b>Ограничение выплаты %s</b>\n", a.Asset.Code)
+
+		if a.PayoutCap > 0 {
+			fmt.Fprintf(rep, "\nЛимит: %s %s\n", stellar.FormatAmount(a.PayoutCap, 2), a.Asset.Code)
+		}
+
+		for _, d := range distributes {
+			if d.Capped == 0 {
+				continue
+			}
+
+			fmt.Fprintf(rep, "\n<a href=\"%s\">%s</a>: -%s",
+				strings.Join([]string{bsnViewerPrefix, d.Recommender}, ""),
+				accountAbbr(d.Recommender),
+				stellar.FormatAmount(d.Capped, 2))
+		}
+	}
+
+	for _, a := range res.Assets {
+		if a.Carryover > 0 {
+			fmt.Fprintf(rep, "\n\nПеренос на следующий отчет: %s %s", stellar.FormatAmount(a.Carryover, 7), a.Asset.Code)
+		}
+
+		if len(a.Owed) > 0 {
+			fmt.Fprintf(rep, "\n\nОстатки к следующей выплате в %s: %d рекомендателей", a.Asset.Code, len(a.Owed))
+		}
 
+		writePending(rep, a)
+	}
+
+	if len(res.GraphIssues) > 0 {
+		fmt.Fprintf(rep, "\n\n<b>Проверка графа рекомендаций</b>\n")
+
+		for _, issue := range res.GraphIssues {
+			fmt.Fprintf(rep, "\n%s: %s", graphIssueLabel(issue.Kind), accountLinks(issue.Accounts))
+
+			if issue.Excluded {
+				fmt.Fprintf(rep, " (исключено)")
+			}
+		}
+	}
+
+	if res.Diff != nil {
+		writeDiff(rep, res.Diff)
+	}
+
+	if len(res.Exclusions) > 0 {
+		fmt.Fprintf(rep, "\n\n<b>Исключены из наград</b>\n")
+
+		for _, e := range res.Exclusions {
+			fmt.Fprintf(rep, "\n<a href=\"%s\">%s</a>: %s",
+				strings.Join([]string{bsnViewerPrefix, e.AccountID}, ""),
+				accountAbbr(e.AccountID),
+				html.EscapeString(e.Reason))
+		}
+	}
+
+	if len(res.PendingVesting) > 0 {
+		fmt.Fprintf(rep, "\n\n<b>Ожидает срока удержания</b>\n")
+
+		for _, d := range res.PendingVesting {
+			fmt.Fprintf(rep, "\n<a href=\"%s\">%s</a> -> <a href=\"%s\">%s</a>: +%d MTLAP",
+				strings.Join([]string{bsnViewerPrefix, d.Recommender}, ""),
+				accountAbbr(d.Recommender),
+				strings.Join([]string{bsnViewerPrefix, d.Recommended}, ""),
+				accountAbbr(d.Recommended),
+				d.Delta)
+		}
+	}
+
+	if len(res.Distributes) > 0 {
 		// Группируем дельты по рекомендателю
 		deltasByRecommender := make(map[string][]mlm.RecommendDelta)
 		for _, d := range res.RecommendDeltas {
@@ -74,25 +176,41 @@ func FromDistributeResult(res mlm.DistributeResult) string {
 
 		isEmpty := true
 
-		for _, d := range res.Distributes {
-			if d.Amount == 0 {
-				continue
-			}
+		for _, asset := range distributeAssets(res.Distributes) {
+			fmt.Fprintf(rep, "\n\n<b>Распределение %s</b>\n", asset.Code)
 
-			isEmpty = false
+			for _, d := range assetDistributes(res.Distributes, asset) {
+				if d.Amount == 0 {
+					continue
+				}
 
-			fmt.Fprintf(rep, "\n<a href=\"%s\">%s</a>: %.2f",
-				strings.Join([]string{bsnViewerPrefix, d.Recommender}, ""),
-				accountAbbr(d.Recommender),
-				d.Amount)
-
-			// Выводим рекомендуемые счета с изменением MTLAP
-			if deltas, ok := deltasByRecommender[d.Recommender]; ok {
-				for _, delta := range deltas {
-					fmt.Fprintf(rep, "\n  └ <a href=\"%s\">%s</a>: +%d MTLAP",
-						strings.Join([]string{bsnViewerPrefix, delta.Recommended}, ""),
-						accountAbbr(delta.Recommended),
-						delta.Delta)
+				isEmpty = false
+
+				fmt.Fprintf(rep, "\n<a href=\"%s\">%s</a>: %s",
+					strings.Join([]string{bsnViewerPrefix, d.Recommender}, ""),
+					accountAbbr(d.Recommender),
+					stellar.FormatAmount(d.Amount, 2))
+
+				if d.Claimable {
+					fmt.Fprintf(rep, " (claimable balance)")
+				}
+
+				// Выводим рекомендуемые счета с изменением MTLAP один раз, при первой выплате рекомендателю
+				if deltas, ok := deltasByRecommender[d.Recommender]; ok {
+					for _, delta := range deltas {
+						fmt.Fprintf(rep, "\n  └ <a href=\"%s\">%s</a>: +%d MTLAP",
+							strings.Join([]string{bsnViewerPrefix, delta.Recommended}, ""),
+							accountAbbr(delta.Recommended),
+							delta.Delta)
+
+						if delta.Level > 1 {
+							fmt.Fprintf(rep, " (уровень %d через <a href=\"%s\">%s</a>)",
+								delta.Level,
+								strings.Join([]string{bsnViewerPrefix, delta.Via}, ""),
+								accountAbbr(delta.Via))
+						}
+					}
+					delete(deltasByRecommender, d.Recommender)
 				}
 			}
 		}
@@ -105,6 +223,135 @@ func FromDistributeResult(res mlm.DistributeResult) string {
 	return rep.String()
 }
 
+// writeDiff выводит изменения по сравнению с прошлым отчетом
+func writeDiff(rep *strings.Builder, diff *mlm.ReportDiff) {
+	fmt.Fprintf(rep, "\n\n<b>Изменения с отчета #%d</b>\n", diff.From)
+
+	writeAccounts(rep, "Новые рекомендатели", diff.NewRecommenders)
+	writeAccounts(rep, "Пропавшие рекомендатели", diff.VanishedRecommenders)
+
+	if len(diff.Moved) > 0 {
+		fmt.Fprintf(rep, "\nСменили рекомендателя:")
+		for _, m := range diff.Moved {
+			fmt.Fprintf(rep, "\n  %s: %s -> %s", accountLink(m.Recommended), accountLinks(m.From), accountLinks(m.To))
+		}
+	}
+
+	if len(diff.MTLAPDrops) > 0 {
+		fmt.Fprintf(rep, "\nПадение MTLAP:")
+		for _, d := range diff.MTLAPDrops {
+			fmt.Fprintf(rep, "\n  %s: %d -> %d", accountLink(d.Recommended), d.From, d.To)
+		}
+	}
+
+	writeAccounts(rep, "Новые конфликты", diff.ConflictsAppeared)
+	writeAccounts(rep, "Разрешенные конфликты", diff.ConflictsResolved)
+
+	if len(diff.NewRecommenders)+len(diff.VanishedRecommenders)+len(diff.Moved)+
+		len(diff.MTLAPDrops)+len(diff.ConflictsAppeared)+len(diff.ConflictsResolved) == 0 {
+		fmt.Fprintf(rep, "\nБез изменений")
+	}
+}
+
+func writeAccounts(rep *strings.Builder, title string, accounts []string) {
+	if len(accounts) == 0 {
+		return
+	}
+
+	fmt.Fprintf(rep, "\n%s: %s", title, accountLinks(accounts))
+}
+
+func accountLink(accountID string) string {
+	return fmt.Sprintf("<a href=\"%s\">%s</a>", strings.Join([]string{bsnViewerPrefix, accountID}, ""), accountAbbr(accountID))
+}
+
+func accountLinks(accounts []string) string {
+	return strings.Join(lo.Map(accounts, func(accountID string, _ int) string { return accountLink(accountID) }), ", ")
+}
+
+// graphIssueLabel возвращает описание нарушения в графе рекомендаций для отчета
+func graphIssueLabel(kind string) string {
+	switch kind {
+	case mlm.GraphIssueSelfLoop:
+		return "Рекомендует сам себя"
+	case mlm.GraphIssueMutual:
+		return "Взаимная рекомендация"
+	case mlm.GraphIssueCycle:
+		return "Цикл рекомендаций"
+	default:
+		return kind
+	}
+}
+
+// writePending выводит суммы, которые копятся до минимальной выплаты
+func writePending(rep *strings.Builder, a mlm.AssetDistribution) {
+	pending := lo.Filter(a.Owed, func(o mlm.Owed, _ int) bool { return owedAmount(o) > 0 })
+	if len(pending) == 0 {
+		return
+	}
+
+	fmt.Fprintf(rep, "\n\n<b>Накоплено до выплаты %s</b>\n", a.Asset.Code)
+
+	if a.MinPayout > 0 {
+		fmt.Fprintf(rep, "\nМинимальная выплата: %s %s\n", stellar.FormatAmount(a.MinPayout, 2), a.Asset.Code)
+	}
+
+	for _, o := range pending {
+		fmt.Fprintf(rep, "\n<a href=\"%s\">%s</a>: %s",
+			strings.Join([]string{bsnViewerPrefix, o.AccountID}, ""),
+			accountAbbr(o.AccountID),
+			stellar.FormatAmount(owedAmount(o), 7))
+	}
+}
+
+// owedAmount возвращает целую часть долга в строупах
+func owedAmount(o mlm.Owed) int64 {
+	return new(big.Int).Div(o.Amount.Num(), o.Amount.Denom()).Int64()
+}
+
+func writeArrears(rep *strings.Builder, title string, arrears []mlm.Arrear) {
+	if len(arrears) == 0 {
+		return
+	}
+
+	fmt.Fprintf(rep, "\n\n<b>%s</b>\n", title)
+
+	for _, a := range arrears {
+		fmt.Fprintf(rep, "\n<a href=\"%s\">%s</a>: %s %s с %s",
+			strings.Join([]string{bsnViewerPrefix, a.AccountID}, ""),
+			accountAbbr(a.AccountID),
+			stellar.FormatAmount(a.Amount, 2),
+			a.Asset.Code,
+			a.CreatedAt.Format(time.DateOnly))
+	}
+}
+
+func hasCapped(distributes []db.ReportDistribute) bool {
+	for _, d := range distributes {
+		if d.Capped > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// distributeAssets возвращает активы выплат в порядке первого появления
+func distributeAssets(distributes []db.ReportDistribute) []mlm.Asset {
+	return lo.Uniq(lo.Map(distributes, func(d db.ReportDistribute, _ int) mlm.Asset {
+		return mlm.Asset{Code: d.Asset, Issuer: d.Issuer}
+	}))
+}
+
+func assetDistributes(distributes []db.ReportDistribute, asset mlm.Asset) []db.ReportDistribute {
+	return lo.Filter(distributes, func(d db.ReportDistribute, _ int) bool {
+		return d.Asset == asset.Code && d.Issuer == asset.Issuer
+	})
+}
+
+func missingTrustlineAssets(missing []mlm.MissingTrustline) []mlm.Asset {
+	return lo.Uniq(lo.Map(missing, func(mt mlm.MissingTrustline, _ int) mlm.Asset { return mt.Asset }))
+}
+
 func accountAbbr(accountID string) string {
 	return accountID[:5] + "..." + accountID[len(accountID)-5:]
 }
@@ -118,3 +365,41 @@ func nextDistributionDate(from time.Time) time.Time {
 
 	return time.Date(year, month+1, 6, 0, 0, 0, 0, from.Location())
 }
+
+func conflictResolutionLabel(resolution string) string {
+	switch resolution {
+	case mlm.ConflictResolutionSplit:
+		return " (поровну)"
+	case mlm.ConflictResolutionWon:
+		return " (засчитано)"
+	case mlm.ConflictResolutionLost:
+		return " (не засчитано)"
+	default:
+		return ""
+	}
+}
+
+// budgetDescription описывает политику бюджета и ее входные данные
+func budgetDescription(b mlm.Budget) string {
+	switch b.Policy {
+	case config.BudgetPolicyFixed:
+		return fmt.Sprintf("фиксированный, %s %s (баланс %s %s)",
+			stellar.FormatAmount(b.Amount, 2), b.Asset.Code,
+			stellar.FormatAmount(b.Balance, 2), b.Asset.Code)
+	case config.BudgetPolicyPercent:
+		return fmt.Sprintf("%.2f%% от баланса %s %s",
+			b.Percent,
+			stellar.FormatAmount(b.Balance, 2), b.Asset.Code)
+	case config.BudgetPolicyReserve:
+		return fmt.Sprintf("баланс %s %s за вычетом резерва %s %s",
+			stellar.FormatAmount(b.Balance, 2), b.Asset.Code,
+			stellar.FormatAmount(b.Reserve, 2), b.Asset.Code)
+	case config.BudgetPolicyEUR:
+		return fmt.Sprintf("%s EUR = %s %s по текущему курсу (баланс %s %s)",
+			stellar.FormatAmount(b.EUR, 2),
+			stellar.FormatAmount(b.EURInAsset, 2), b.Asset.Code,
+			stellar.FormatAmount(b.Balance, 2), b.Asset.Code)
+	default:
+		return b.Policy
+	}
+}
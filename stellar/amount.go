@@ -0,0 +1,20 @@
+package stellar
+
+import (
+	"strings"
+
+	"github.com/stellar/go/amount"
+)
+
+// FormatAmount formats an amount in stroops with the given number of decimals.
+// Extra digits are truncated, so the result never exceeds the actual amount.
+func FormatAmount(v int64, decimals int) string {
+	s := amount.StringFromInt64(v)
+
+	dot := strings.IndexByte(s, '.')
+	if decimals <= 0 {
+		return s[:dot]
+	}
+
+	return s[:dot+1+min(decimals, 7)]
+}
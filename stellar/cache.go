@@ -0,0 +1,71 @@
+package stellar
+
+import (
+	"sync"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/protocols/horizon"
+)
+
+// accountCache хранит счета, загруженные за один запуск. Recommenders заполняет его
+// всеми держателями MTLAP, остальные счета добавляются при первом запросе.
+type accountCache struct {
+	mu       sync.RWMutex
+	accounts map[string]horizon.Account
+}
+
+func newAccountCache() *accountCache {
+	return &accountCache{accounts: make(map[string]horizon.Account)}
+}
+
+func (c *accountCache) get(accountID string) (horizon.Account, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	acc, ok := c.accounts[accountID]
+	return acc, ok
+}
+
+func (c *accountCache) set(acc horizon.Account) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.accounts[acc.AccountID] = acc
+}
+
+// delete убирает счет из кэша, например после отправки транзакции с него
+func (c *accountCache) delete(accountID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.accounts, accountID)
+}
+
+// replace заменяет содержимое кэша счетами нового обхода
+func (c *accountCache) replace(accounts []horizon.Account) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.accounts = make(map[string]horizon.Account, len(accounts))
+	for _, acc := range accounts {
+		c.accounts[acc.AccountID] = acc
+	}
+}
+
+// account возвращает счет из кэша или загружает его из Horizon
+func (c *Client) account(accountID string) (horizon.Account, error) {
+	if acc, ok := c.cache.get(accountID); ok {
+		return acc, nil
+	}
+
+	acc, err := c.cl.AccountDetail(horizonclient.AccountRequest{
+		AccountID: accountID,
+	})
+	if err != nil {
+		return horizon.Account{}, err
+	}
+
+	c.cache.set(acc)
+
+	return acc, nil
+}
@@ -0,0 +1,138 @@
+package stellar
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+)
+
+const (
+	claimableBalancesLimit  = 200
+	maxOperationsPerReclaim = 100
+)
+
+// ClaimableBalanceClaimants returns claimants for a reward sent as a claimable balance:
+// the destination can claim it within period, after that only the source can reclaim it
+func ClaimableBalanceClaimants(destination, source string, period time.Duration) []txnbuild.Claimant {
+	before := txnbuild.BeforeRelativeTimePredicate(int64(period.Seconds()))
+	after := txnbuild.NotPredicate(before)
+
+	return []txnbuild.Claimant{
+		txnbuild.NewClaimant(destination, &before),
+		txnbuild.NewClaimant(source, &after),
+	}
+}
+
+// ReclaimableBalances returns claimable balances of the given asset sponsored by accountID
+// that accountID itself can claim at the moment, i.e. expired unclaimed rewards
+func (c *Client) ReclaimableBalances(ctx context.Context, accountID, asset, issuer string, now time.Time) ([]horizon.ClaimableBalance, error) {
+	var res []horizon.ClaimableBalance
+
+	req := horizonclient.ClaimableBalanceRequest{
+		Asset:    fmt.Sprintf("%s:%s", asset, issuer),
+		Sponsor:  accountID,
+		Claimant: accountID,
+		Limit:    claimableBalancesLimit,
+	}
+
+	for {
+		page, err := c.cl.ClaimableBalances(req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cb := range page.Embedded.Records {
+			claimant, ok := lo.Find(cb.Claimants, func(cl horizon.Claimant) bool {
+				return cl.Destination == accountID
+			})
+			if ok && canClaim(claimant.Predicate, now) {
+				res = append(res, cb)
+			}
+		}
+
+		if len(page.Embedded.Records) < claimableBalancesLimit {
+			break
+		}
+
+		req.Cursor = page.Embedded.Records[len(page.Embedded.Records)-1].PagingToken()
+	}
+
+	return res, nil
+}
+
+// ReclaimClaimableBalances claims the given balances back to accountID and returns hashes
+// of submitted transactions. Transactions are signed with seed and submitted like report
+// transactions: if the account is multisig and the seed's weight is below the medium
+// threshold, ErrNotEnoughSignatures is returned.
+func (c *Client) ReclaimClaimableBalances(ctx context.Context, accountID, seed string, balanceIDs []string) ([]string, error) {
+	accountDetail, err := c.cl.AccountDetail(horizonclient.AccountRequest{
+		AccountID: accountID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []string
+
+	for _, chunk := range lo.Chunk(balanceIDs, maxOperationsPerReclaim) {
+		ops := lo.Map(chunk, func(id string, _ int) txnbuild.Operation {
+			return &txnbuild.ClaimClaimableBalance{BalanceID: id}
+		})
+
+		tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+			SourceAccount:        &accountDetail,
+			IncrementSequenceNum: true,
+			Operations:           ops,
+			BaseFee:              TransactionBaseFee,
+			Memo:                 txnbuild.MemoText(fmt.Sprintf("mlta mlm reclaim %s", time.Now().Format(time.DateOnly))),
+			Preconditions: txnbuild.Preconditions{
+				TimeBounds: txnbuild.NewTimeout(300),
+			},
+		})
+		if err != nil {
+			return hashes, err
+		}
+
+		xdr, err := tx.Base64()
+		if err != nil {
+			return hashes, err
+		}
+
+		hash, _, err := c.SubmitXDR(ctx, seed, xdr)
+		if err != nil && hash != "" {
+			return hashes, fmt.Errorf("reclaim transaction %s: %w", hash, err)
+		}
+		if err != nil {
+			return hashes, err
+		}
+
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, nil
+}
+
+// canClaim evaluates a claim predicate at the given time. Relative predicates
+// are converted to absolute ones when the balance is created, so they never match here.
+func canClaim(pred xdr.ClaimPredicate, now time.Time) bool {
+	switch pred.Type {
+	case xdr.ClaimPredicateTypeClaimPredicateUnconditional:
+		return true
+	case xdr.ClaimPredicateTypeClaimPredicateAnd:
+		return lo.EveryBy(*pred.AndPredicates, func(p xdr.ClaimPredicate) bool { return canClaim(p, now) })
+	case xdr.ClaimPredicateTypeClaimPredicateOr:
+		return lo.SomeBy(*pred.OrPredicates, func(p xdr.ClaimPredicate) bool { return canClaim(p, now) })
+	case xdr.ClaimPredicateTypeClaimPredicateNot:
+		return pred.NotPredicate != nil && *pred.NotPredicate != nil && !canClaim(**pred.NotPredicate, now)
+	case xdr.ClaimPredicateTypeClaimPredicateBeforeAbsoluteTime:
+		return now.Unix() < int64(*pred.AbsBefore)
+	default:
+		return false
+	}
+}
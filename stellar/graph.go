@@ -0,0 +1,191 @@
+package stellar
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/mtlprog/mlm"
+	"github.com/samber/lo"
+)
+
+// recommendation is an edge of the recommendation graph
+type recommendation struct {
+	recommender string
+	recommended string
+}
+
+// ValidateGraph finds self-recommendations, mutual pairs and longer cycles in the
+// recommendation graph. Issues are reported or excluded according to the policy for their
+// kind. For excluded issues the recommendations between the involved accounts are removed
+// from recs. A longer cycle is reported as a strongly connected group of three or more
+// accounts. All issues are found on the original graph before anything is excluded.
+func ValidateGraph(recs *mlm.RecommendersFetchResult, policy mlm.GraphPolicy) []mlm.GraphIssue {
+	issues := make([]mlm.GraphIssue, 0)
+	excluded := make(map[recommendation]struct{})
+
+	add := func(kind, kindPolicy string, accounts []string, edges []recommendation) {
+		if kindPolicy == mlm.GraphPolicyIgnore || kindPolicy == "" {
+			return
+		}
+
+		issue := mlm.GraphIssue{Kind: kind, Accounts: accounts}
+
+		if kindPolicy == mlm.GraphPolicyExclude {
+			issue.Excluded = true
+			for _, e := range edges {
+				excluded[e] = struct{}{}
+			}
+		}
+
+		issues = append(issues, issue)
+	}
+
+	edges := graphEdges(recs)
+
+	for _, e := range edges {
+		if e.recommender == e.recommended {
+			add(mlm.GraphIssueSelfLoop, policy.SelfLoop, []string{e.recommender}, []recommendation{e})
+		}
+	}
+
+	edgeSet := lo.SliceToMap(edges, func(e recommendation) (recommendation, struct{}) { return e, struct{}{} })
+
+	for _, e := range edges {
+		back := recommendation{e.recommended, e.recommender}
+		if _, ok := edgeSet[back]; ok && e.recommender < e.recommended {
+			add(mlm.GraphIssueMutual, policy.Mutual, []string{e.recommender, e.recommended}, []recommendation{e, back})
+		}
+	}
+
+	for _, component := range stronglyConnected(edges) {
+		if len(component) < 3 {
+			continue
+		}
+
+		inside := lo.SliceToMap(component, func(accountID string) (string, struct{}) { return accountID, struct{}{} })
+		cycleEdges := lo.Filter(edges, func(e recommendation, _ int) bool {
+			_, from := inside[e.recommender]
+			_, to := inside[e.recommended]
+			return from && to
+		})
+
+		add(mlm.GraphIssueCycle, policy.Cycle, component, cycleEdges)
+	}
+
+	if len(excluded) > 0 {
+		excludeRecommendations(recs, excluded)
+	}
+
+	return issues
+}
+
+// graphEdges returns recommendations of recs in the order they appear
+func graphEdges(recs *mlm.RecommendersFetchResult) []recommendation {
+	var edges []recommendation
+
+	for _, recommender := range recs.Recommenders {
+		for _, recommended := range recommender.Recommended {
+			edges = append(edges, recommendation{recommender.AccountID, recommended.AccountID})
+		}
+	}
+
+	return lo.Uniq(edges)
+}
+
+// stronglyConnected returns strongly connected components of the graph using Tarjan's
+// algorithm. Accounts in each component and the components themselves are sorted.
+func stronglyConnected(edges []recommendation) [][]string {
+	adjacency := make(map[string][]string)
+	var nodes []string
+
+	for _, e := range edges {
+		if _, ok := adjacency[e.recommender]; !ok {
+			nodes = append(nodes, e.recommender)
+		}
+		adjacency[e.recommender] = append(adjacency[e.recommender], e.recommended)
+	}
+
+	var (
+		index      int
+		stack      []string
+		indices    = make(map[string]int)
+		lowlinks   = make(map[string]int)
+		onStack    = make(map[string]bool)
+		components [][]string
+		connect    func(v string)
+	)
+
+	connect = func(v string) {
+		indices[v] = index
+		lowlinks[v] = index
+		index++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range adjacency[v] {
+			if _, ok := indices[w]; !ok {
+				connect(w)
+				lowlinks[v] = min(lowlinks[v], lowlinks[w])
+			} else if onStack[w] {
+				lowlinks[v] = min(lowlinks[v], indices[w])
+			}
+		}
+
+		if lowlinks[v] != indices[v] {
+			return
+		}
+
+		var component []string
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			component = append(component, w)
+			if w == v {
+				break
+			}
+		}
+
+		slices.Sort(component)
+		components = append(components, component)
+	}
+
+	for _, v := range nodes {
+		if _, ok := indices[v]; !ok {
+			connect(v)
+		}
+	}
+
+	slices.SortFunc(components, func(a, b []string) int {
+		return strings.Compare(a[0], b[0])
+	})
+
+	return components
+}
+
+// excludeRecommendations removes the given recommendations from recs and from its conflicts
+func excludeRecommendations(recs *mlm.RecommendersFetchResult, excluded map[recommendation]struct{}) {
+	for i, recommender := range recs.Recommenders {
+		recs.Recommenders[i].Recommended = lo.Filter(recommender.Recommended, func(r mlm.Recommended, _ int) bool {
+			if _, ok := excluded[recommendation{recommender.AccountID, r.AccountID}]; ok {
+				recs.TotalRecommendedMTLAP -= r.MTLAP
+				return false
+			}
+			return true
+		})
+	}
+
+	for recommended, recommenders := range recs.Conflict {
+		left := lo.Filter(recommenders, func(recommender string, _ int) bool {
+			_, ok := excluded[recommendation{recommender, recommended}]
+			return !ok
+		})
+
+		if len(left) < 2 {
+			delete(recs.Conflict, recommended)
+			continue
+		}
+
+		recs.Conflict[recommended] = left
+	}
+}
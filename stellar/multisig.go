@@ -0,0 +1,157 @@
+package stellar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+)
+
+// ErrNotEnoughSignatures — вес подписей транзакции меньше среднего порога счета
+var ErrNotEnoughSignatures = errors.New("not enough signatures")
+
+// SignXDR добавляет к транзакции подпись seed, сохраняя уже собранные подписи
+func (c *Client) SignXDR(xdr, seed string) (string, error) {
+	pair, err := keypair.ParseFull(seed)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := parseTransaction(xdr)
+	if err != nil {
+		return "", err
+	}
+
+	if hasSignature(tx, pair.Hint()) {
+		return xdr, nil
+	}
+
+	tx, err = tx.Sign(c.passphrase, pair)
+	if err != nil {
+		return "", err
+	}
+
+	return tx.Base64()
+}
+
+// MergeSignatures добавляет к транзакции xdr подписи из signed — той же транзакции,
+// подписанной в другом месте. Транзакции сравниваются по хэшу, поэтому подписанная
+// транзакция не может отличаться ни одной операцией.
+func (c *Client) MergeSignatures(xdr, signed string) (string, error) {
+	tx, err := parseTransaction(xdr)
+	if err != nil {
+		return "", err
+	}
+
+	signedTx, err := parseTransaction(signed)
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := tx.Hash(c.passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	signedHash, err := signedTx.Hash(c.passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	if hash != signedHash {
+		return "", fmt.Errorf("signed transaction differs from the report transaction")
+	}
+
+	for _, sig := range signedTx.Signatures() {
+		if hasSignature(tx, sig.Hint) {
+			continue
+		}
+
+		tx, err = tx.AddSignatureDecorated(sig)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return tx.Base64()
+}
+
+// TransactionHash возвращает хэш транзакции в сети клиента. Подписи на хэш не влияют.
+func (c *Client) TransactionHash(xdr string) (string, error) {
+	tx, err := parseTransaction(xdr)
+	if err != nil {
+		return "", err
+	}
+
+	return tx.HashHex(c.passphrase)
+}
+
+// SignatureWeight возвращает суммарный вес подписей транзакции и вес, нужный для
+// выплат, — средний порог счета-источника. Учитываются только подписи ключей,
+// которые есть среди подписантов счета, каждый ключ один раз.
+func (c *Client) SignatureWeight(ctx context.Context, xdr string) (int32, int32, error) {
+	tx, err := parseTransaction(xdr)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	acc, err := c.account(tx.SourceAccount().AccountID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	hash, err := tx.Hash(c.passphrase)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var weight int32
+
+	for _, signer := range acc.Signers {
+		if signer.Type != "ed25519_public_key" || signer.Weight <= 0 {
+			continue
+		}
+
+		kp, err := keypair.ParseAddress(signer.Key)
+		if err != nil {
+			continue
+		}
+
+		for _, sig := range tx.Signatures() {
+			if sig.Hint == kp.Hint() && kp.Verify(hash[:], sig.Signature) == nil {
+				weight += signer.Weight
+				break
+			}
+		}
+	}
+
+	// Нулевой порог все равно требует хотя бы одну подпись
+	return weight, max(int32(acc.Thresholds.MedThreshold), 1), nil
+}
+
+// checkSignatureWeight возвращает ErrNotEnoughSignatures, если подписей не хватает для выплат
+func (c *Client) checkSignatureWeight(ctx context.Context, xdr string) error {
+	weight, threshold, err := c.SignatureWeight(ctx, xdr)
+	if err != nil {
+		return err
+	}
+
+	if weight < threshold {
+		return fmt.Errorf("%w: weight %d of %d", ErrNotEnoughSignatures, weight, threshold)
+	}
+
+	return nil
+}
+
+func hasSignature(tx *txnbuild.Transaction, hint xdr.SignatureHint) bool {
+	for _, sig := range tx.Signatures() {
+		if bytes.Equal(sig.Hint[:], hint[:]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,243 @@
+package stellar
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtlprog/mlm"
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/txnbuild"
+)
+
+// RetryPolicy — правила повтора запросов к Horizon. Пауза перед повтором растет
+// от BaseDelay вдвое с каждой попыткой, но не больше MaxDelay, и случайно уменьшается
+// до половины, чтобы параллельные запросы не повторялись одновременно.
+// Retry-After и X-Ratelimit-Reset из ответа Horizon имеют приоритет над паузой,
+// но тоже ограничены MaxDelay.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+var (
+	// DefaultReadRetryPolicy повторяет чтение при 429, 5xx и сетевых ошибках
+	DefaultReadRetryPolicy = RetryPolicy{MaxRetries: 5, BaseDelay: 500 * time.Millisecond, MaxDelay: 30 * time.Second}
+	// DefaultSubmitRetryPolicy повторяет отправку транзакции, только когда Horizon
+	// точно ее не принял: при 429 и 503
+	DefaultSubmitRetryPolicy = RetryPolicy{MaxRetries: 2, BaseDelay: 2 * time.Second, MaxDelay: 30 * time.Second}
+)
+
+// RetryingClient повторяет запросы к Horizon по отдельным правилам для чтения
+// и для отправки транзакций. Каждый повтор пишется в лог. Методы Horizon не принимают
+// контекст, поэтому паузы между повторами прерывает контекст, переданный при создании.
+type RetryingClient struct {
+	mlm.HorizonClient
+	ctx    context.Context
+	read   RetryPolicy
+	submit RetryPolicy
+	log    *slog.Logger
+}
+
+// RetryOption настраивает RetryingClient
+type RetryOption func(*RetryingClient)
+
+// WithReadRetryPolicy задает правила повтора запросов на чтение
+func WithReadRetryPolicy(p RetryPolicy) RetryOption {
+	return func(c *RetryingClient) {
+		c.read = p
+	}
+}
+
+// WithSubmitRetryPolicy задает правила повтора отправки транзакций
+func WithSubmitRetryPolicy(p RetryPolicy) RetryOption {
+	return func(c *RetryingClient) {
+		c.submit = p
+	}
+}
+
+func NewRetryingClient(ctx context.Context, cl mlm.HorizonClient, log *slog.Logger, opts ...RetryOption) *RetryingClient {
+	c := &RetryingClient{
+		HorizonClient: cl,
+		ctx:           ctx,
+		read:          DefaultReadRetryPolicy,
+		submit:        DefaultSubmitRetryPolicy,
+		log:           log,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *RetryingClient) Root() (horizon.Root, error) {
+	return retryRead(c, "Root", c.HorizonClient.Root)
+}
+
+func (c *RetryingClient) Accounts(request horizonclient.AccountsRequest) (horizon.AccountsPage, error) {
+	return retryRead(c, "Accounts", func() (horizon.AccountsPage, error) {
+		return c.HorizonClient.Accounts(request)
+	})
+}
+
+func (c *RetryingClient) NextAccountsPage(page horizon.AccountsPage) (horizon.AccountsPage, error) {
+	return retryRead(c, "NextAccountsPage", func() (horizon.AccountsPage, error) {
+		return c.HorizonClient.NextAccountsPage(page)
+	})
+}
+
+func (c *RetryingClient) AccountDetail(request horizonclient.AccountRequest) (horizon.Account, error) {
+	return retryRead(c, "AccountDetail", func() (horizon.Account, error) {
+		return c.HorizonClient.AccountDetail(request)
+	})
+}
+
+func (c *RetryingClient) ClaimableBalances(request horizonclient.ClaimableBalanceRequest) (horizon.ClaimableBalances, error) {
+	return retryRead(c, "ClaimableBalances", func() (horizon.ClaimableBalances, error) {
+		return c.HorizonClient.ClaimableBalances(request)
+	})
+}
+
+func (c *RetryingClient) StrictSendPaths(request horizonclient.StrictSendPathsRequest) (horizon.PathsPage, error) {
+	return retryRead(c, "StrictSendPaths", func() (horizon.PathsPage, error) {
+		return c.HorizonClient.StrictSendPaths(request)
+	})
+}
+
+func (c *RetryingClient) TransactionDetail(txHash string) (horizon.Transaction, error) {
+	return retryRead(c, "TransactionDetail", func() (horizon.Transaction, error) {
+		return c.HorizonClient.TransactionDetail(txHash)
+	})
+}
+
+// SubmitTransaction повторяет отправку только по правилам для транзакций: при таймауте
+// или обрыве соединения транзакция могла быть принята, и повтор решает вызывающий.
+func (c *RetryingClient) SubmitTransaction(tx *txnbuild.Transaction) (horizon.Transaction, error) {
+	return retry(c, c.submit, "SubmitTransaction", isRetryableSubmit, func() (horizon.Transaction, error) {
+		return c.HorizonClient.SubmitTransaction(tx)
+	})
+}
+
+func retryRead[T any](c *RetryingClient, call string, fn func() (T, error)) (T, error) {
+	return retry(c, c.read, call, isRetryableRead, fn)
+}
+
+func retry[T any](c *RetryingClient, p RetryPolicy, call string, retryable func(error) bool, fn func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := fn()
+		if err == nil || attempt > p.MaxRetries || !retryable(err) {
+			return res, err
+		}
+
+		delay := p.backoff(attempt)
+		if d, ok := serverDelay(err, time.Now()); ok {
+			delay = d
+			if p.MaxDelay > 0 {
+				delay = min(delay, p.MaxDelay)
+			}
+		}
+
+		c.log.WarnContext(c.ctx, "horizon request failed, retrying",
+			slog.String("call", call),
+			slog.Int("attempt", attempt),
+			slog.Int("status", statusCode(err)),
+			slog.Duration("delay", delay),
+			slog.String("error", err.Error()),
+		)
+
+		select {
+		case <-c.ctx.Done():
+			return res, errors.Join(err, c.ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff возвращает паузу перед повтором attempt со случайным разбросом
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay <= 0 || (p.MaxDelay > 0 && delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// serverDelay возвращает паузу, которую попросил Horizon: Retry-After в секундах
+// или HTTP-дате, а при исчерпании лимита — X-Ratelimit-Reset в секундах
+func serverDelay(err error, now time.Time) (time.Duration, bool) {
+	var hErr *horizonclient.Error
+	if !errors.As(err, &hErr) || hErr.Response == nil {
+		return 0, false
+	}
+
+	header := hErr.Response.Header
+
+	if v := header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			return max(at.Sub(now), 0), true
+		}
+	}
+
+	if hErr.Response.StatusCode == http.StatusTooManyRequests {
+		if seconds, err := strconv.Atoi(header.Get("X-Ratelimit-Reset")); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	return 0, false
+}
+
+func statusCode(err error) int {
+	var hErr *horizonclient.Error
+	if errors.As(err, &hErr) && hErr.Response != nil {
+		return hErr.Response.StatusCode
+	}
+	return 0
+}
+
+// isRetryableRead — чтение можно повторять при перегрузке, ошибке сервера и сбое сети.
+// Ответ прокси с ошибкой не в формате Horizon клиент отдает как ошибку разбора без статуса,
+// его тоже повторяем.
+func isRetryableRead(err error) bool {
+	switch status := statusCode(err); {
+	case status == http.StatusTooManyRequests, status >= http.StatusInternalServerError:
+		return true
+	case status != 0:
+		return false
+	}
+
+	var netErr net.Error
+	var urlErr *url.Error
+	return errors.As(err, &netErr) || errors.As(err, &urlErr) ||
+		strings.Contains(err.Error(), "error decoding horizon.Problem")
+}
+
+// isRetryableSubmit — отправку можно повторять, только если Horizon ее отклонил, не обработав
+func isRetryableSubmit(err error) bool {
+	switch statusCode(err) {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	default:
+		return false
+	}
+}
+
+var _ mlm.HorizonClient = &RetryingClient{}
@@ -3,16 +3,16 @@ package stellar
 import (
 	"context"
 	"encoding/base64"
+	"maps"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/mtlprog/mlm"
 	"github.com/samber/lo"
 	"github.com/stellar/go/clients/horizonclient"
-	"github.com/stellar/go/keypair"
 	"github.com/stellar/go/network"
 	"github.com/stellar/go/protocols/horizon"
-	"github.com/stellar/go/txnbuild"
 )
 
 const (
@@ -31,14 +31,52 @@ const (
 	minMTLAPApplicableRecommender = 4
 )
 
+// TransactionBaseFee — комиссия за операцию в транзакциях программы, в строупах
+const TransactionBaseFee = 1000
+
+// Assets — активы, с которыми работает клиент: MTLAP для графа рекомендаций,
+// EURMTL для обмена и LABR как актив награды по умолчанию
+type Assets struct {
+	MTLAP  mlm.Asset
+	EURMTL mlm.Asset
+	LABR   mlm.Asset
+}
+
+// DefaultAssets возвращает активы основной сети
+func DefaultAssets() Assets {
+	return Assets{
+		MTLAP:  mlm.Asset{Code: MTLAPAsset, Issuer: MTLAPIssuer},
+		EURMTL: mlm.Asset{Code: EURMTLAsset, Issuer: EURMTLIssuer},
+		LABR:   mlm.Asset{Code: LABRAsset, Issuer: LABRIssuer},
+	}
+}
+
 type Client struct {
-	cl mlm.HorizonClient
+	cl         mlm.HorizonClient
+	passphrase string
+	assets     Assets
+	cache      *accountCache
+}
+
+// Option настраивает Client
+type Option func(*Client)
+
+// WithNetworkPassphrase задает сеть, для которой подписываются транзакции
+func WithNetworkPassphrase(passphrase string) Option {
+	return func(c *Client) {
+		c.passphrase = passphrase
+	}
+}
+
+// WithAssets задает активы MTLAP, EURMTL и LABR, например тестовых эмитентов
+func WithAssets(assets Assets) Option {
+	return func(c *Client) {
+		c.assets = assets
+	}
 }
 
 func (c *Client) Balance(ctx context.Context, accountID, asset, issuer string) (string, error) {
-	acc, err := c.cl.AccountDetail(horizonclient.AccountRequest{
-		AccountID: accountID,
-	})
+	acc, err := c.account(accountID)
 	if err != nil {
 		return "", err
 	}
@@ -47,9 +85,7 @@ func (c *Client) Balance(ctx context.Context, accountID, asset, issuer string) (
 }
 
 func (c *Client) HasTrustline(ctx context.Context, accountID, asset, issuer string) (bool, error) {
-	acc, err := c.cl.AccountDetail(horizonclient.AccountRequest{
-		AccountID: accountID,
-	})
+	acc, err := c.account(accountID)
 	if err != nil {
 		return false, err
 	}
@@ -63,77 +99,95 @@ func (c *Client) HasTrustline(ctx context.Context, accountID, asset, issuer stri
 	return false, nil
 }
 
+// Recommenders обходит всех держателей MTLAP и строит граф рекомендаций.
+// Вместе с результатом возвращается снимок исходных данных и номер ledger,
+// последнего в Horizon на начало обхода. Загруженные счета заменяют кэш счетов,
+// поэтому Balance, HasTrustline и AccountDetail для них не ходят в Horizon.
 func (c *Client) Recommenders(ctx context.Context) (*mlm.RecommendersFetchResult, error) {
+	root, err := c.cl.Root()
+	if err != nil {
+		return nil, err
+	}
+
 	var allAccounts []horizon.Account
 	accp, err := c.cl.Accounts(horizonclient.AccountsRequest{
-		Asset: MTLAPAssetRequest,
+		Asset: c.assets.MTLAP.String(),
 		Limit: DefaultLimit,
 	})
 	if err != nil {
 		return nil, err
 	}
-	if len(accp.Embedded.Records) < DefaultLimit {
-		return accountsToResult(accp.Embedded.Records), nil
-	}
 
-	for {
+	for len(accp.Embedded.Records) > 0 {
 		allAccounts = append(allAccounts, accp.Embedded.Records...)
+		if len(accp.Embedded.Records) < DefaultLimit {
+			break
+		}
+
 		accp, err = c.cl.NextAccountsPage(accp)
 		if err != nil {
 			return nil, err
 		}
-		if len(accp.Embedded.Records) == 0 {
-			break
-		}
 	}
 
-	return accountsToResult(allAccounts), nil
+	c.cache.replace(allAccounts)
+
+	return RecommendersFromSnapshot(&mlm.Snapshot{
+		Ledger:   int64(root.HorizonSequence),
+		Accounts: lo.Map(allAccounts, func(acc horizon.Account, _ int) mlm.SnapshotAccount { return snapshotAccount(acc, c.assets.MTLAP) }),
+	}), nil
 }
 
 func (c *Client) AccountDetail(accountID string) (horizon.Account, error) {
-	return c.cl.AccountDetail(horizonclient.AccountRequest{
-		AccountID: accountID,
-	})
+	return c.account(accountID)
 }
 
-func (c *Client) SubmitXDR(ctx context.Context, seed, xdr string) (string, error) {
-	pair, err := keypair.ParseFull(seed)
-	if err != nil {
-		return "", err
+// NewClient создает клиента. По умолчанию транзакции подписываются для основной сети
+// и используются активы основной сети.
+func NewClient(cl mlm.HorizonClient, opts ...Option) *Client {
+	c := &Client{
+		cl:         cl,
+		passphrase: network.PublicNetworkPassphrase,
+		assets:     DefaultAssets(),
+		cache:      newAccountCache(),
 	}
 
-	txg, err := txnbuild.TransactionFromXDR(xdr)
-	if err != nil {
-		return "", err
+	for _, opt := range opts {
+		opt(c)
 	}
 
-	tx, _ := txg.Transaction()
+	return c
+}
 
-	tx, err = tx.Sign(network.PublicNetworkPassphrase, pair)
-	if err != nil {
-		return "", err
-	}
+// Assets возвращает активы, с которыми работает клиент
+func (c *Client) Assets() Assets {
+	return c.assets
+}
 
-	res, err := c.cl.SubmitTransaction(tx)
-	if err != nil {
-		return "", err
+// snapshotAccount оставляет от аккаунта только то, что нужно для расчета рекомендаций
+func snapshotAccount(acc horizon.Account, mtlap mlm.Asset) mlm.SnapshotAccount {
+	return mlm.SnapshotAccount{
+		AccountID: acc.AccountID,
+		MTLAP:     acc.GetCreditBalance(mtlap.Code, mtlap.Issuer),
+		Data: lo.PickBy(acc.Data, func(k, v string) bool {
+			return strings.HasPrefix(k, TagRecommend)
+		}),
 	}
-
-	return res.Hash, nil
 }
 
-func NewClient(cl horizonclient.ClientInterface) *Client {
-	return &Client{cl: cl}
-}
+// RecommendersFromSnapshot строит граф рекомендаций из снимка держателей MTLAP.
+// Один и тот же снимок всегда дает один и тот же граф.
+func RecommendersFromSnapshot(snapshot *mlm.Snapshot) *mlm.RecommendersFetchResult {
+	accs := snapshot.Accounts
 
-func accountsToResult(accs []horizon.Account) *mlm.RecommendersFetchResult {
 	res := &mlm.RecommendersFetchResult{
 		Conflict: make(map[string][]string),
+		Snapshot: snapshot,
 	}
 	uniqueRecommendeds := make(map[string]struct{})
 	lastRecommendedRecommenders := make(map[string]string)
 
-	accMap := lo.Associate(accs, func(acc horizon.Account) (string, horizon.Account) {
+	accMap := lo.Associate(accs, func(acc mlm.SnapshotAccount) (string, mlm.SnapshotAccount) {
 		return acc.AccountID, acc
 	})
 
@@ -151,7 +205,9 @@ func accountsToResult(accs []horizon.Account) *mlm.RecommendersFetchResult {
 		}
 
 		recommendeds := make([]mlm.Recommended, 0, len(recommendedDataMap))
-		for _, v := range recommendedDataMap {
+		// Порядок записей в map случаен, сортируем ключи, чтобы граф был воспроизводим
+		for _, k := range slices.Sorted(maps.Keys(recommendedDataMap)) {
+			v := recommendedDataMap[k]
 			recommended, ok := accMap[decodeBase64(v)]
 			if !ok {
 				continue
@@ -165,7 +221,7 @@ func accountsToResult(accs []horizon.Account) *mlm.RecommendersFetchResult {
 				res.Conflict[recommended.AccountID] = append(res.Conflict[recommended.AccountID], recommender.AccountID)
 			}
 
-			mtlapBalance := getBalanceInt64(recommended, MTLAPAsset, MTLAPIssuer)
+			mtlapBalance := parseBalanceInt64(recommended.MTLAP)
 
 			res.TotalRecommendedMTLAP += mtlapBalance
 
@@ -187,8 +243,15 @@ func accountsToResult(accs []horizon.Account) *mlm.RecommendersFetchResult {
 	return res
 }
 
-func isRecommenderApplicable(acc horizon.Account) bool {
-	mtlapBalance, _ := strconv.ParseFloat(acc.GetCreditBalance(MTLAPAsset, MTLAPIssuer), 64)
+// MTLAPBalances возвращает целые балансы MTLAP всех держателей из снимка
+func MTLAPBalances(snapshot *mlm.Snapshot) map[string]int64 {
+	return lo.Associate(snapshot.Accounts, func(acc mlm.SnapshotAccount) (string, int64) {
+		return acc.AccountID, parseBalanceInt64(acc.MTLAP)
+	})
+}
+
+func isRecommenderApplicable(acc mlm.SnapshotAccount) bool {
+	mtlapBalance, _ := strconv.ParseFloat(acc.MTLAP, 64)
 	return mtlapBalance >= minMTLAPApplicableRecommender
 }
 
@@ -200,8 +263,8 @@ func decodeBase64(s string) string {
 	return string(b)
 }
 
-func getBalanceInt64(acc horizon.Account, asset, issuer string) int64 {
-	balance, err := strconv.ParseFloat(acc.GetCreditBalance(asset, issuer), 64)
+func parseBalanceInt64(s string) int64 {
+	balance, err := strconv.ParseFloat(s, 64)
 	if err != nil {
 		return 0
 	}
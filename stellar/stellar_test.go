@@ -2,11 +2,23 @@ package stellar_test
 
 import (
 	"context"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/mtlprog/mlm"
 	"github.com/mtlprog/mlm/stellar"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/protocols/horizon/base"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
 	"github.com/stretchr/testify/require"
 )
 
@@ -36,3 +48,461 @@ func TestClient_Fetch(t *testing.T) {
 
 	spew.Dump(res.Conflict)
 }
+
+// fakeHorizon отдает заданных держателей MTLAP и считает запросы AccountDetail
+type fakeHorizon struct {
+	horizonclient.ClientInterface
+	accounts []horizon.Account
+	details  atomic.Int32
+}
+
+func (f *fakeHorizon) Root() (horizon.Root, error) {
+	return horizon.Root{HorizonSequence: 1}, nil
+}
+
+func (f *fakeHorizon) Accounts(horizonclient.AccountsRequest) (horizon.AccountsPage, error) {
+	var page horizon.AccountsPage
+	page.Embedded.Records = f.accounts
+	return page, nil
+}
+
+func (f *fakeHorizon) AccountDetail(req horizonclient.AccountRequest) (horizon.Account, error) {
+	f.details.Add(1)
+	return horizon.Account{AccountID: req.AccountID}, nil
+}
+
+func (f *fakeHorizon) ClaimableBalances(horizonclient.ClaimableBalanceRequest) (horizon.ClaimableBalances, error) {
+	return horizon.ClaimableBalances{}, nil
+}
+
+func (f *fakeHorizon) StrictSendPaths(horizonclient.StrictSendPathsRequest) (horizon.PathsPage, error) {
+	return horizon.PathsPage{}, nil
+}
+
+func TestClient_AccountCache(t *testing.T) {
+	ctx := context.Background()
+
+	holder := horizon.Account{
+		AccountID: "HOLDER",
+		Balances: []horizon.Balance{
+			{Balance: "5.0000000", Asset: base.Asset{Code: stellar.MTLAPAsset, Issuer: stellar.MTLAPIssuer}},
+			{Balance: "1.0000000", Asset: base.Asset{Code: stellar.LABRAsset, Issuer: stellar.LABRIssuer}},
+		},
+	}
+
+	fake := &fakeHorizon{accounts: []horizon.Account{holder}}
+	cl := stellar.NewClient(fake)
+
+	_, err := cl.Recommenders(ctx)
+	require.NoError(t, err)
+
+	has, err := cl.HasTrustline(ctx, "HOLDER", stellar.LABRAsset, stellar.LABRIssuer)
+	require.NoError(t, err)
+	require.True(t, has)
+
+	balance, err := cl.Balance(ctx, "HOLDER", stellar.MTLAPAsset, stellar.MTLAPIssuer)
+	require.NoError(t, err)
+	require.Equal(t, "5.0000000", balance)
+	require.Zero(t, fake.details.Load(), "держатели MTLAP берутся из обхода")
+
+	has, err = cl.HasTrustline(ctx, "OTHER", stellar.LABRAsset, stellar.LABRIssuer)
+	require.NoError(t, err)
+	require.False(t, has)
+
+	_, err = cl.AccountDetail("OTHER")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, fake.details.Load(), "остальные счета загружаются один раз")
+}
+
+// flakyHorizon отвечает ошибками с заданными статусами и заголовком Retry-After,
+// пока они не кончатся
+type flakyHorizon struct {
+	mlm.HorizonClient
+	statuses   []int
+	retryAfter string
+	calls      int
+}
+
+func (f *flakyHorizon) fail() error {
+	f.calls++
+	if len(f.statuses) == 0 {
+		return nil
+	}
+
+	status := f.statuses[0]
+	f.statuses = f.statuses[1:]
+
+	header := http.Header{}
+	if f.retryAfter != "" {
+		header.Set("Retry-After", f.retryAfter)
+	}
+
+	return &horizonclient.Error{Response: &http.Response{StatusCode: status, Header: header}}
+}
+
+func (f *flakyHorizon) AccountDetail(req horizonclient.AccountRequest) (horizon.Account, error) {
+	return horizon.Account{AccountID: req.AccountID}, f.fail()
+}
+
+func (f *flakyHorizon) SubmitTransaction(*txnbuild.Transaction) (horizon.Transaction, error) {
+	return horizon.Transaction{Hash: "hash"}, f.fail()
+}
+
+func TestRetryingClient(t *testing.T) {
+	policy := stellar.RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	newClient := func(statuses ...int) (*flakyHorizon, *stellar.RetryingClient) {
+		fake := &flakyHorizon{statuses: statuses}
+		return fake, stellar.NewRetryingClient(context.Background(), fake, slog.New(slog.DiscardHandler),
+			stellar.WithReadRetryPolicy(policy),
+			stellar.WithSubmitRetryPolicy(policy),
+		)
+	}
+
+	t.Run("чтение повторяется при 429 и 5xx", func(t *testing.T) {
+		fake, cl := newClient(http.StatusTooManyRequests, http.StatusBadGateway)
+
+		acc, err := cl.AccountDetail(horizonclient.AccountRequest{AccountID: "A"})
+		require.NoError(t, err)
+		require.Equal(t, "A", acc.AccountID)
+		require.Equal(t, 3, fake.calls)
+	})
+
+	t.Run("чтение не повторяется при 404", func(t *testing.T) {
+		fake, cl := newClient(http.StatusNotFound)
+
+		_, err := cl.AccountDetail(horizonclient.AccountRequest{AccountID: "A"})
+		require.Error(t, err)
+		require.Equal(t, 1, fake.calls)
+	})
+
+	t.Run("попытки кончаются", func(t *testing.T) {
+		fake, cl := newClient(http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+
+		_, err := cl.AccountDetail(horizonclient.AccountRequest{AccountID: "A"})
+		require.Error(t, err)
+		require.Equal(t, 3, fake.calls)
+	})
+
+	t.Run("пауза из Retry-After не больше MaxDelay", func(t *testing.T) {
+		fake, cl := newClient(http.StatusTooManyRequests)
+		fake.retryAfter = "3600"
+
+		start := time.Now()
+		_, err := cl.AccountDetail(horizonclient.AccountRequest{AccountID: "A"})
+		require.NoError(t, err)
+		require.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("отмена контекста прерывает паузу", func(t *testing.T) {
+		fake := &flakyHorizon{statuses: []int{http.StatusServiceUnavailable}}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		cl := stellar.NewRetryingClient(ctx, fake, slog.New(slog.DiscardHandler),
+			stellar.WithReadRetryPolicy(stellar.RetryPolicy{MaxRetries: 2, BaseDelay: time.Hour, MaxDelay: time.Hour}),
+		)
+
+		_, err := cl.AccountDetail(horizonclient.AccountRequest{AccountID: "A"})
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, 1, fake.calls)
+	})
+
+	t.Run("отправка повторяется при 503", func(t *testing.T) {
+		fake, cl := newClient(http.StatusServiceUnavailable)
+
+		tx, err := cl.SubmitTransaction(nil)
+		require.NoError(t, err)
+		require.Equal(t, "hash", tx.Hash)
+		require.Equal(t, 2, fake.calls)
+	})
+
+	t.Run("отправка не повторяется при 504", func(t *testing.T) {
+		fake, cl := newClient(http.StatusGatewayTimeout)
+
+		_, err := cl.SubmitTransaction(nil)
+		require.Error(t, err)
+		require.Equal(t, 1, fake.calls)
+	})
+}
+
+// submitHorizon отвечает на отправку ошибкой с заданным статусом и находит в сети landed.
+// Счет-источник подписывают signers с весом 1 каждый и средним порогом threshold.
+type submitHorizon struct {
+	mlm.HorizonClient
+	status    int
+	code      string
+	landed    *horizon.Transaction
+	signers   []string
+	threshold byte
+	submitted int
+	last      *txnbuild.Transaction
+}
+
+func (f *submitHorizon) AccountDetail(req horizonclient.AccountRequest) (horizon.Account, error) {
+	acc := horizon.Account{AccountID: req.AccountID}
+	acc.Thresholds.MedThreshold = f.threshold
+
+	signers := f.signers
+	if signers == nil {
+		signers = []string{req.AccountID}
+	}
+	for _, key := range signers {
+		acc.Signers = append(acc.Signers, horizon.Signer{Key: key, Weight: 1, Type: "ed25519_public_key"})
+	}
+
+	return acc, nil
+}
+
+func (f *submitHorizon) SubmitTransaction(tx *txnbuild.Transaction) (horizon.Transaction, error) {
+	f.submitted++
+	f.last = tx
+	if f.status != 0 {
+		hErr := &horizonclient.Error{Response: &http.Response{StatusCode: f.status}}
+		if f.code != "" {
+			hErr.Problem.Extras = map[string]any{"result_codes": map[string]any{"transaction": f.code}}
+		}
+		return horizon.Transaction{}, hErr
+	}
+	return horizon.Transaction{}, nil
+}
+
+func (f *submitHorizon) TransactionDetail(string) (horizon.Transaction, error) {
+	if f.landed == nil {
+		return horizon.Transaction{}, &horizonclient.Error{Response: &http.Response{StatusCode: http.StatusNotFound}}
+	}
+	return *f.landed, nil
+}
+
+// buildTestTransaction возвращает неподписанную транзакцию со счета source
+func buildTestTransaction(t *testing.T, source string) (*txnbuild.Transaction, string) {
+	t.Helper()
+
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &txnbuild.SimpleAccount{AccountID: source, Sequence: 1},
+		IncrementSequenceNum: true,
+		Operations:           []txnbuild.Operation{&txnbuild.BumpSequence{BumpTo: 2}},
+		BaseFee:              txnbuild.MinBaseFee,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewTimeout(60)},
+	})
+	require.NoError(t, err)
+
+	xdr, err := tx.Base64()
+	require.NoError(t, err)
+
+	return tx, xdr
+}
+
+func TestClient_SubmitXDR(t *testing.T) {
+	ctx := context.Background()
+	source := keypair.MustRandom()
+	tx, xdr := buildTestTransaction(t, source.Address())
+
+	for _, tc := range []struct {
+		name   string
+		fake   *submitHorizon
+		status string
+		err    bool
+	}{
+		{"выполнена", &submitHorizon{}, mlm.TransactionSuccess, false},
+		{"таймаут, но выполнена", &submitHorizon{status: http.StatusGatewayTimeout, landed: &horizon.Transaction{Successful: true}}, mlm.TransactionSuccess, false},
+		{"таймаут и не найдена", &submitHorizon{status: http.StatusGatewayTimeout}, mlm.TransactionUnknown, true},
+		{"отклонена", &submitHorizon{status: http.StatusBadRequest, code: "tx_failed"}, mlm.TransactionFailed, true},
+		{"sequence number использован", &submitHorizon{status: http.StatusBadRequest, code: "tx_bad_seq"}, mlm.TransactionFailed, true},
+		{"перегрузка", &submitHorizon{status: http.StatusServiceUnavailable}, mlm.TransactionUnknown, true},
+		{"лимит запросов", &submitHorizon{status: http.StatusTooManyRequests}, mlm.TransactionUnknown, true},
+		{"выполнена с ошибкой", &submitHorizon{status: http.StatusBadRequest, landed: &horizon.Transaction{}}, mlm.TransactionFailed, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hash, status, err := stellar.NewClient(tc.fake).SubmitXDR(ctx, source.Seed(), xdr)
+			require.Equal(t, tc.status, status)
+			require.Equal(t, tc.err, err != nil)
+
+			expected, herr := tx.HashHex(network.PublicNetworkPassphrase)
+			require.NoError(t, herr)
+			require.Equal(t, expected, hash)
+		})
+	}
+
+	expired, err := stellar.TransactionExpired(xdr, time.Now())
+	require.NoError(t, err)
+	require.False(t, expired)
+
+	expired, err = stellar.TransactionExpired(xdr, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.True(t, expired)
+}
+
+func TestClient_Multisig(t *testing.T) {
+	ctx := context.Background()
+	source := keypair.MustRandom()
+	signer1 := keypair.MustRandom()
+	signer2 := keypair.MustRandom()
+	_, xdr := buildTestTransaction(t, source.Address())
+
+	fake := &submitHorizon{signers: []string{signer1.Address(), signer2.Address()}, threshold: 2}
+	cl := stellar.NewClient(fake)
+
+	signed, err := cl.SignXDR(xdr, signer1.Seed())
+	require.NoError(t, err)
+
+	// Подпись не из списка подписантов не добавляет веса
+	signed, err = cl.SignXDR(signed, keypair.MustRandom().Seed())
+	require.NoError(t, err)
+
+	weight, threshold, err := cl.SignatureWeight(ctx, signed)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, weight)
+	require.EqualValues(t, 2, threshold)
+
+	_, _, err = cl.SubmitXDR(ctx, "", signed)
+	require.ErrorIs(t, err, stellar.ErrNotEnoughSignatures)
+	require.Zero(t, fake.submitted)
+
+	// Вторую подпись собрали в другом месте
+	elsewhere, err := cl.SignXDR(xdr, signer2.Seed())
+	require.NoError(t, err)
+
+	signed, err = cl.MergeSignatures(signed, elsewhere)
+	require.NoError(t, err)
+
+	weight, _, err = cl.SignatureWeight(ctx, signed)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, weight)
+
+	_, status, err := cl.SubmitXDR(ctx, "", signed)
+	require.NoError(t, err)
+	require.Equal(t, mlm.TransactionSuccess, status)
+
+	_, other := buildTestTransaction(t, keypair.MustRandom().Address())
+	_, err = cl.MergeSignatures(signed, other)
+	require.Error(t, err)
+}
+
+func TestClient_ReclaimClaimableBalances(t *testing.T) {
+	ctx := context.Background()
+	program := keypair.MustRandom()
+	signer := keypair.MustRandom()
+	ids := []string{"00000000da0d57da7d4850e7fc10d2a9d0ebc731f7afb40574c03395b17d49149b91f5be"}
+
+	t.Run("со счета программы подписью ключа", func(t *testing.T) {
+		fake := &submitHorizon{signers: []string{signer.Address()}, threshold: 1}
+
+		hashes, err := stellar.NewClient(fake).ReclaimClaimableBalances(ctx, program.Address(), signer.Seed(), ids)
+		require.NoError(t, err)
+		require.Len(t, hashes, 1)
+
+		require.Equal(t, program.Address(), fake.last.SourceAccount().AccountID)
+		require.EqualValues(t, stellar.TransactionBaseFee, fake.last.BaseFee())
+	})
+
+	t.Run("не хватает подписей", func(t *testing.T) {
+		fake := &submitHorizon{signers: []string{signer.Address(), keypair.MustRandom().Address()}, threshold: 2}
+
+		_, err := stellar.NewClient(fake).ReclaimClaimableBalances(ctx, program.Address(), signer.Seed(), ids)
+		require.ErrorIs(t, err, stellar.ErrNotEnoughSignatures)
+		require.Zero(t, fake.submitted)
+	})
+}
+
+func TestFormatAmount(t *testing.T) {
+	require.Equal(t, "12.3456789", stellar.FormatAmount(123456789, 7))
+	require.Equal(t, "12.34", stellar.FormatAmount(123456789, 2))
+	require.Equal(t, "12", stellar.FormatAmount(123456789, 0))
+	require.Equal(t, "0.0000001", stellar.FormatAmount(1, 7))
+}
+
+func TestClaimableBalanceClaimants(t *testing.T) {
+	claimants := stellar.ClaimableBalanceClaimants("dest", "source", 30*24*time.Hour)
+	require.Len(t, claimants, 2)
+
+	require.Equal(t, "dest", claimants[0].Destination)
+	require.Equal(t, xdr.ClaimPredicateTypeClaimPredicateBeforeRelativeTime, claimants[0].Predicate.Type)
+	require.Equal(t, xdr.Int64(30*24*60*60), *claimants[0].Predicate.RelBefore)
+
+	require.Equal(t, "source", claimants[1].Destination)
+	require.Equal(t, xdr.ClaimPredicateTypeClaimPredicateNot, claimants[1].Predicate.Type)
+}
+
+func TestRecommendersFromSnapshot(t *testing.T) {
+	data := func(accountID string) string { return base64.StdEncoding.EncodeToString([]byte(accountID)) }
+
+	snapshot := &mlm.Snapshot{
+		Ledger: 100,
+		Accounts: []mlm.SnapshotAccount{
+			{AccountID: "rec1", MTLAP: "5.0000000", Data: map[string]string{
+				"RecommendToMTLA2": data("user2"),
+				"RecommendToMTLA1": data("user1"),
+			}},
+			{AccountID: "rec2", MTLAP: "4.0000000", Data: map[string]string{"RecommendToMTLA": data("user1")}},
+			{AccountID: "rec3", MTLAP: "3.0000000", Data: map[string]string{"RecommendToMTLA": data("user2")}}, // мало MTLAP
+			{AccountID: "user1", MTLAP: "2.0000000"},
+			{AccountID: "user2", MTLAP: "1.0000000"},
+		},
+	}
+
+	res := stellar.RecommendersFromSnapshot(snapshot)
+
+	require.Same(t, snapshot, res.Snapshot)
+	require.Equal(t, []mlm.Recommender{
+		{AccountID: "rec1", Recommended: []mlm.Recommended{{AccountID: "user1", MTLAP: 2}, {AccountID: "user2", MTLAP: 1}}},
+		{AccountID: "rec2", Recommended: []mlm.Recommended{{AccountID: "user1", MTLAP: 2}}},
+	}, res.Recommenders)
+	require.Equal(t, map[string][]string{"user1": {"rec1", "rec2"}}, res.Conflict)
+	require.Equal(t, int64(5), res.TotalRecommendedMTLAP)
+}
+
+func TestValidateGraph(t *testing.T) {
+	newRecs := func() *mlm.RecommendersFetchResult {
+		return &mlm.RecommendersFetchResult{
+			Recommenders: []mlm.Recommender{
+				{AccountID: "a", Recommended: []mlm.Recommended{{AccountID: "a", MTLAP: 5}, {AccountID: "user", MTLAP: 1}}},
+				{AccountID: "b", Recommended: []mlm.Recommended{{AccountID: "c", MTLAP: 5}}},
+				{AccountID: "c", Recommended: []mlm.Recommended{{AccountID: "b", MTLAP: 5}, {AccountID: "user", MTLAP: 1}}},
+				{AccountID: "x", Recommended: []mlm.Recommended{{AccountID: "y", MTLAP: 5}}},
+				{AccountID: "y", Recommended: []mlm.Recommended{{AccountID: "z", MTLAP: 5}}},
+				{AccountID: "z", Recommended: []mlm.Recommended{{AccountID: "x", MTLAP: 5}}},
+			},
+			Conflict:              map[string][]string{"user": {"a", "c"}},
+			TotalRecommendedMTLAP: 32,
+		}
+	}
+
+	t.Run("flag", func(t *testing.T) {
+		recs := newRecs()
+
+		issues := stellar.ValidateGraph(recs, mlm.GraphPolicy{
+			SelfLoop: mlm.GraphPolicyFlag,
+			Mutual:   mlm.GraphPolicyFlag,
+			Cycle:    mlm.GraphPolicyFlag,
+		})
+
+		require.Equal(t, []mlm.GraphIssue{
+			{Kind: mlm.GraphIssueSelfLoop, Accounts: []string{"a"}},
+			{Kind: mlm.GraphIssueMutual, Accounts: []string{"b", "c"}},
+			{Kind: mlm.GraphIssueCycle, Accounts: []string{"x", "y", "z"}},
+		}, issues)
+		require.Equal(t, newRecs(), recs)
+	})
+
+	t.Run("exclude", func(t *testing.T) {
+		recs := newRecs()
+
+		issues := stellar.ValidateGraph(recs, mlm.GraphPolicy{
+			SelfLoop: mlm.GraphPolicyExclude,
+			Mutual:   mlm.GraphPolicyExclude,
+			Cycle:    mlm.GraphPolicyIgnore,
+		})
+
+		require.Equal(t, []mlm.GraphIssue{
+			{Kind: mlm.GraphIssueSelfLoop, Accounts: []string{"a"}, Excluded: true},
+			{Kind: mlm.GraphIssueMutual, Accounts: []string{"b", "c"}, Excluded: true},
+		}, issues)
+		require.Equal(t, []mlm.Recommended{{AccountID: "user", MTLAP: 1}}, recs.Recommenders[0].Recommended)
+		require.Empty(t, recs.Recommenders[1].Recommended)
+		require.Equal(t, []mlm.Recommended{{AccountID: "user", MTLAP: 1}}, recs.Recommenders[2].Recommended)
+		require.Len(t, recs.Recommenders[3].Recommended, 1)
+		require.Equal(t, map[string][]string{"user": {"a", "c"}}, recs.Conflict)
+		require.Equal(t, int64(17), recs.TotalRecommendedMTLAP)
+	})
+}
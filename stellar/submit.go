@@ -0,0 +1,142 @@
+package stellar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mtlprog/mlm"
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/txnbuild"
+)
+
+// expiryMargin — запас после истечения срока транзакции, за который ее еще можно
+// увидеть в Horizon: ledger закрывается несколько секунд, Horizon загружает его с задержкой
+const expiryMargin = 5 * time.Minute
+
+// SubmitXDR подписывает транзакцию seed, если он задан, и отправляет ее. Транзакция может
+// уже содержать подписи других ключей; если их вес с подписью seed меньше среднего
+// порога счета, транзакция не отправляется и возвращается ErrNotEnoughSignatures
+// без состояния. Хэш считается до отправки и возвращается вместе с состоянием:
+// success, failed или unknown. Если ответ Horizon не говорит
+// однозначно, попала ли транзакция в сеть, ее хэш проверяется в Horizon; если транзакция
+// не найдена, состояние unknown, и результат нужно сверить позже через TransactionStatus.
+// Повторная отправка той же транзакции безопасна: второй раз она не выполнится.
+func (c *Client) SubmitXDR(ctx context.Context, seed, xdr string) (string, string, error) {
+	if seed != "" {
+		var err error
+		xdr, err = c.SignXDR(xdr, seed)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	if err := c.checkSignatureWeight(ctx, xdr); err != nil {
+		return "", "", err
+	}
+
+	tx, err := parseTransaction(xdr)
+	if err != nil {
+		return "", "", err
+	}
+
+	hash, err := tx.HashHex(c.passphrase)
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = c.cl.SubmitTransaction(tx)
+
+	// Sequence number счета изменился или мог измениться
+	c.cache.delete(tx.SourceAccount().AccountID)
+
+	if err == nil {
+		return hash, mlm.TransactionSuccess, nil
+	}
+
+	// Транзакция могла попасть в сеть при прошлой отправке или несмотря на ошибку
+	status, statusErr := c.TransactionStatus(ctx, hash)
+	switch {
+	case statusErr != nil:
+		return hash, mlm.TransactionUnknown, errors.Join(err, statusErr)
+	case status == mlm.TransactionSuccess:
+		return hash, status, nil
+	case status == mlm.TransactionFailed || isRejected(err):
+		return hash, mlm.TransactionFailed, err
+	default:
+		return hash, mlm.TransactionUnknown, err
+	}
+}
+
+// TransactionStatus возвращает состояние транзакции по хэшу: success или failed,
+// если она есть в сети, и unknown, если Horizon ее не знает
+func (c *Client) TransactionStatus(ctx context.Context, hash string) (string, error) {
+	tx, err := c.cl.TransactionDetail(hash)
+	if err != nil {
+		if statusCode(err) == http.StatusNotFound {
+			return mlm.TransactionUnknown, nil
+		}
+		return "", err
+	}
+
+	if tx.Successful {
+		return mlm.TransactionSuccess, nil
+	}
+
+	return mlm.TransactionFailed, nil
+}
+
+// TransactionExpired сообщает, что срок действия транзакции истек и она уже не может
+// попасть в сеть. Транзакции без верхней границы срока не истекают.
+func TransactionExpired(xdr string, now time.Time) (bool, error) {
+	tx, err := parseTransaction(xdr)
+	if err != nil {
+		return false, err
+	}
+
+	maxTime := tx.Timebounds().MaxTime
+	if maxTime == 0 {
+		return false, nil
+	}
+
+	return now.After(time.Unix(maxTime, 0).Add(expiryMargin)), nil
+}
+
+func parseTransaction(xdr string) (*txnbuild.Transaction, error) {
+	txg, err := txnbuild.TransactionFromXDR(xdr)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, ok := txg.Transaction()
+	if !ok {
+		return nil, fmt.Errorf("fee bump transactions are not supported")
+	}
+
+	return tx, nil
+}
+
+// isRejected — Horizon отклонил транзакцию при проверке: она не прошла (tx_failed)
+// или ее sequence number уже не подходит (tx_bad_seq). Остальные ошибки, в том числе
+// 429 и 503 после повторов RetryingClient, не исключают, что одна из отправок
+// попала в сеть, поэтому результат остается неизвестным до истечения срока транзакции.
+func isRejected(err error) bool {
+	var hErr *horizonclient.Error
+	if !errors.As(err, &hErr) || statusCode(err) != http.StatusBadRequest {
+		return false
+	}
+
+	codes, err := hErr.ResultCodes()
+	if err != nil {
+		return false
+	}
+
+	switch codes.TransactionCode {
+	case "tx_failed", "tx_bad_seq":
+		return true
+	default:
+		return false
+	}
+}
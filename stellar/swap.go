@@ -3,13 +3,12 @@ package stellar
 import (
 	"context"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/stellar/go/amount"
 	"github.com/stellar/go/clients/horizonclient"
 	"github.com/stellar/go/keypair"
-	"github.com/stellar/go/network"
 	"github.com/stellar/go/txnbuild"
 )
 
@@ -19,18 +18,20 @@ type SwappableToken struct {
 	Issuer string
 }
 
-// SwappableTokens is a list of tokens that can be swapped to LABR
+// SwappableTokens returns the list of tokens that can be swapped to LABR
 // Add new tokens here as needed
-var SwappableTokens = []SwappableToken{
-	{Code: EURMTLAsset, Issuer: EURMTLIssuer},
+func (c *Client) SwappableTokens() []SwappableToken {
+	return []SwappableToken{
+		{Code: c.assets.EURMTL.Code, Issuer: c.assets.EURMTL.Issuer},
+	}
 }
 
-// SwapResult represents the result of a single swap operation
+// SwapResult represents the result of a single swap operation, amounts are in stroops
 type SwapResult struct {
 	FromAsset    string
-	FromAmount   float64
+	FromAmount   int64
 	ToAsset      string
-	ToAmount     float64
+	ToAmount     int64
 	TxHash       string
 	PricePerLABR float64
 }
@@ -40,8 +41,8 @@ type SwapSummary struct {
 	Swaps         []SwapResult
 	PriceExceeded []PriceExceededAlert
 	Errors        []SwapError
-	TotalFromEUR  float64
-	TotalToLABR   float64
+	TotalFromEUR  int64
+	TotalToLABR   int64
 }
 
 // SwapError represents an error during swap
@@ -54,16 +55,16 @@ type SwapError struct {
 // PriceExceededAlert represents an alert when price threshold is exceeded
 type PriceExceededAlert struct {
 	FromAsset    string
-	FromAmount   float64
+	FromAmount   int64
 	PricePerLABR float64
 	Threshold    float64
 }
 
-// TokenBalance represents a balance of a specific token
+// TokenBalance represents a balance of a specific token in stroops
 type TokenBalance struct {
 	Code    string
 	Issuer  string
-	Balance float64
+	Balance int64
 }
 
 // GetSwappableBalances returns balances of all swappable tokens for the given account
@@ -76,12 +77,12 @@ func (c *Client) GetSwappableBalances(ctx context.Context, accountID string) ([]
 	}
 
 	var balances []TokenBalance
-	for _, token := range SwappableTokens {
+	for _, token := range c.SwappableTokens() {
 		balStr := acc.GetCreditBalance(token.Code, token.Issuer)
 		if balStr == "" {
 			continue // no trustline or zero balance
 		}
-		bal, err := strconv.ParseFloat(balStr, 64)
+		bal, err := amount.ParseInt64(balStr)
 		if err != nil {
 			continue
 		}
@@ -111,18 +112,17 @@ func (c *Client) GetSwapPriceForAmount(
 	ctx context.Context,
 	sourceCode, sourceIssuer string,
 	destCode, destIssuer string,
-	amount float64,
-) (float64, error) {
+	sourceAmount int64,
+) (int64, error) {
 	pr := horizonclient.StrictSendPathsRequest{
-		SourceAmount:      fmt.Sprintf("%.7f", amount),
+		SourceAmount:      amount.StringFromInt64(sourceAmount),
 		SourceAssetCode:   sourceCode,
 		SourceAssetIssuer: sourceIssuer,
 		SourceAssetType:   getAssetType(sourceCode),
 		DestinationAssets: fmt.Sprintf("%s:%s", destCode, destIssuer),
 	}
 
-	// Use public net client directly for path finding
-	paths, err := horizonclient.DefaultPublicNetClient.StrictSendPaths(pr)
+	paths, err := c.cl.StrictSendPaths(pr)
 	if err != nil {
 		// Try to get more details from Horizon error
 		if hErr, ok := err.(*horizonclient.Error); ok {
@@ -138,7 +138,7 @@ func (c *Client) GetSwapPriceForAmount(
 
 	// Get the best path (first one)
 	bestPath := paths.Embedded.Records[0]
-	destAmount, err := strconv.ParseFloat(bestPath.DestinationAmount, 64)
+	destAmount, err := amount.ParseInt64(bestPath.DestinationAmount)
 	if err != nil {
 		return 0, err
 	}
@@ -151,8 +151,8 @@ func (c *Client) SwapToLABR(
 	ctx context.Context,
 	accountID, seed string,
 	sourceCode, sourceIssuer string,
-	amount float64,
-) (string, float64, error) {
+	sourceAmount int64,
+) (string, int64, error) {
 	if seed == "" {
 		return "", 0, fmt.Errorf("STELLAR_SEED is not set")
 	}
@@ -171,15 +171,14 @@ func (c *Client) SwapToLABR(
 
 	// Get the best path first to determine intermediate assets
 	pr := horizonclient.StrictSendPathsRequest{
-		SourceAmount:      fmt.Sprintf("%.7f", amount),
+		SourceAmount:      amount.StringFromInt64(sourceAmount),
 		SourceAssetCode:   sourceCode,
 		SourceAssetIssuer: sourceIssuer,
 		SourceAssetType:   getAssetType(sourceCode),
-		DestinationAssets: fmt.Sprintf("%s:%s", LABRAsset, LABRIssuer),
+		DestinationAssets: c.assets.LABR.String(),
 	}
 
-	// Use public net client directly for path finding
-	paths, err := horizonclient.DefaultPublicNetClient.StrictSendPaths(pr)
+	paths, err := c.cl.StrictSendPaths(pr)
 	if err != nil {
 		return "", 0, err
 	}
@@ -189,13 +188,13 @@ func (c *Client) SwapToLABR(
 	}
 
 	bestPath := paths.Embedded.Records[0]
-	destAmount, err := strconv.ParseFloat(bestPath.DestinationAmount, 64)
+	destAmount, err := amount.ParseInt64(bestPath.DestinationAmount)
 	if err != nil {
 		return "", 0, err
 	}
 
 	// Apply 2% slippage tolerance to the expected destination amount
-	minDestAmount := destAmount * 0.98
+	minDestAmount := destAmount * 98 / 100
 
 	// Build path assets
 	var pathAssets []txnbuild.Asset
@@ -212,14 +211,14 @@ func (c *Client) SwapToLABR(
 	}
 
 	sendAsset := txnbuild.CreditAsset{Code: sourceCode, Issuer: sourceIssuer}
-	destAsset := txnbuild.CreditAsset{Code: LABRAsset, Issuer: LABRIssuer}
+	destAsset := txnbuild.CreditAsset{Code: c.assets.LABR.Code, Issuer: c.assets.LABR.Issuer}
 
 	op := &txnbuild.PathPaymentStrictSend{
 		SendAsset:   sendAsset,
-		SendAmount:  fmt.Sprintf("%.7f", amount),
+		SendAmount:  amount.StringFromInt64(sourceAmount),
 		Destination: accountID,
 		DestAsset:   destAsset,
-		DestMin:     fmt.Sprintf("%.7f", minDestAmount),
+		DestMin:     amount.StringFromInt64(minDestAmount),
 		Path:        pathAssets,
 	}
 
@@ -237,7 +236,7 @@ func (c *Client) SwapToLABR(
 		return "", 0, err
 	}
 
-	tx, err = tx.Sign(network.PublicNetworkPassphrase, pair)
+	tx, err = tx.Sign(c.passphrase, pair)
 	if err != nil {
 		return "", 0, err
 	}
@@ -273,7 +272,7 @@ func (c *Client) ExecuteSwaps(
 
 	for _, bal := range balances {
 		// Get price for the FULL amount (order book depth matters)
-		totalLABR, err := c.GetSwapPriceForAmount(ctx, bal.Code, bal.Issuer, LABRAsset, LABRIssuer, bal.Balance)
+		totalLABR, err := c.GetSwapPriceForAmount(ctx, bal.Code, bal.Issuer, c.assets.LABR.Code, c.assets.LABR.Issuer, bal.Balance)
 		if err != nil {
 			summary.Errors = append(summary.Errors, SwapError{
 				Asset: bal.Code,
@@ -285,7 +284,7 @@ func (c *Client) ExecuteSwaps(
 
 		// Price per LABR in source asset terms (average price for the full amount)
 		// If 200 EURMTL = 10 LABR, then 1 LABR = 20 EURMTL
-		pricePerLABR := bal.Balance / totalLABR
+		pricePerLABR := float64(bal.Balance) / float64(totalLABR)
 
 		// Don't swap if price is too high (above threshold)
 		if pricePerLABR > priceMaxThreshold {
@@ -311,7 +310,7 @@ func (c *Client) ExecuteSwaps(
 		result := SwapResult{
 			FromAsset:    bal.Code,
 			FromAmount:   bal.Balance,
-			ToAsset:      LABRAsset,
+			ToAsset:      c.assets.LABR.Code,
 			ToAmount:     actualAmount,
 			TxHash:       hash,
 			PricePerLABR: pricePerLABR,
@@ -334,12 +333,12 @@ func FormatSwapReport(summary *SwapSummary) string {
 	report := "<b>Token Swap Report</b>\n\n"
 
 	for _, swap := range summary.Swaps {
-		report += fmt.Sprintf("%.2f %s -> %.2f %s\n", swap.FromAmount, swap.FromAsset, swap.ToAmount, swap.ToAsset)
+		report += fmt.Sprintf("%s %s -> %s %s\n", FormatAmount(swap.FromAmount, 2), swap.FromAsset, FormatAmount(swap.ToAmount, 2), swap.ToAsset)
 		report += fmt.Sprintf("Price: 1 LABR = %.2f %s\n", swap.PricePerLABR, swap.FromAsset)
 		report += fmt.Sprintf("TX: %s\n\n", swap.TxHash[:8]+"..."+swap.TxHash[len(swap.TxHash)-8:])
 	}
 
-	report += fmt.Sprintf("<b>Total:</b> %.2f EURMTL -> %.2f LABR", summary.TotalFromEUR, summary.TotalToLABR)
+	report += fmt.Sprintf("<b>Total:</b> %s EURMTL -> %s LABR", FormatAmount(summary.TotalFromEUR, 2), FormatAmount(summary.TotalToLABR, 2))
 
 	return report
 }
@@ -353,7 +352,7 @@ func FormatPriceAlert(alerts []PriceExceededAlert, mentionUsername string) strin
 	report := fmt.Sprintf("<b>Price Alert</b> @%s\n\n", mentionUsername)
 
 	for _, alert := range alerts {
-		report += fmt.Sprintf("Cannot swap %.2f %s\n", alert.FromAmount, alert.FromAsset)
+		report += fmt.Sprintf("Cannot swap %s %s\n", FormatAmount(alert.FromAmount, 2), alert.FromAsset)
 		report += fmt.Sprintf("Current price: 1 LABR = %.2f %s\n", alert.PricePerLABR, alert.FromAsset)
 		report += fmt.Sprintf("Threshold: %.2f %s\n\n", alert.Threshold, alert.FromAsset)
 	}